@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	deferredPostKindTime   = "time"
+	deferredPostKindOnline = "online"
+	deferredPostKindHeld   = "held"
+)
+
+// DeferredPostSummary describes a pending deferred post for the admins.
+type DeferredPostSummary struct {
+	ID                    string `json:"id"`
+	Kind                  string `json:"kind"`
+	UserID                string `json:"user_id"`
+	UserDeactivated       bool   `json:"user_deactivated,omitempty"`
+	ChannelID             string `json:"channel_id"`
+	SendAt                int64  `json:"send_at,omitempty"`
+	WaitingForID          string `json:"waiting_for_id,omitempty"`
+	WaitingForDeactivated bool   `json:"waiting_for_deactivated,omitempty"`
+	Message               string `json:"message,omitempty"`
+	Files                 int    `json:"files,omitempty"`
+}
+
+// DeferredPostsReport summarizes the pending deferred posts.
+type DeferredPostsReport struct {
+	Total            int                    `json:"total"`
+	Deferred         int                    `json:"deferred"`
+	WaitingForOnline int                    `json:"waiting_for_online"`
+	Held             int                    `json:"held"`
+	Users            map[string]int         `json:"users"`
+	Posts            []*DeferredPostSummary `json:"posts"`
+}
+
+// deferredPostsFilter selects the pending deferred posts of a report.
+// Orphaned selects only the posts of deactivated users, or waiting for them
+// to be online.
+type deferredPostsFilter struct {
+	UserID      string
+	ChannelID   string
+	Orphaned    bool
+	ShowContent bool
+}
+
+func (f *deferredPostsFilter) matches(post *model.Post) bool {
+	return (f.UserID == "" || post.UserId == f.UserID) && (f.ChannelID == "" || post.ChannelId == f.ChannelID)
+}
+
+// deferredPostsReport returns the pending deferred posts that match the
+// filter, sorted by the time they are sent. The posts waiting for users to be
+// online, and the ones held during quiet hours, go last. The messages are
+// redacted unless ShowContent is set.
+func (p *Plugin) deferredPostsReport(filter *deferredPostsFilter) *DeferredPostsReport {
+	report := &DeferredPostsReport{Users: map[string]int{}, Posts: []*DeferredPostSummary{}}
+	isDeactivated := p.deactivationChecker()
+	add := func(post *model.Post, summary *DeferredPostSummary) bool {
+		summary.UserDeactivated = isDeactivated(post.UserId)
+		if summary.WaitingForID != "" {
+			summary.WaitingForDeactivated = isDeactivated(summary.WaitingForID)
+		}
+		if filter.Orphaned && !summary.UserDeactivated && !summary.WaitingForDeactivated {
+			return false
+		}
+		summary.ID = post.Id
+		summary.UserID = post.UserId
+		summary.ChannelID = post.ChannelId
+		summary.Files = len(post.FileIds)
+		if filter.ShowContent {
+			summary.Message = post.Message
+		}
+		report.Users[post.UserId]++
+		report.Posts = append(report.Posts, summary)
+		return true
+	}
+
+	for _, deferredPost := range p.deferredPosts {
+		if !filter.matches(deferredPost.Post) {
+			continue
+		}
+		summary := &DeferredPostSummary{
+			Kind:   deferredPostKindTime,
+			SendAt: deferredPost.Time.UnixNano() / int64(time.Millisecond),
+		}
+		if add(deferredPost.Post, summary) {
+			report.Deferred++
+		}
+	}
+	sort.SliceStable(report.Posts, func(i, j int) bool {
+		return report.Posts[i].SendAt < report.Posts[j].SendAt
+	})
+
+	for _, userID := range sortedUserIDs(p.postsWaitingForOnline) {
+		for _, post := range p.postsWaitingForOnline[userID] {
+			if filter.matches(post) && add(post, &DeferredPostSummary{Kind: deferredPostKindOnline, WaitingForID: userID}) {
+				report.WaitingForOnline++
+			}
+		}
+	}
+	heldPosts := p.heldPostsByUser()
+	for _, userID := range sortedUserIDs(heldPosts) {
+		for _, post := range heldPosts[userID] {
+			if filter.matches(post) && add(post, &DeferredPostSummary{Kind: deferredPostKindHeld, WaitingForID: userID}) {
+				report.Held++
+			}
+		}
+	}
+	report.Total = report.Deferred + report.WaitingForOnline + report.Held
+	return report
+}
+
+// sortedUserIDs returns the users of the posts map, sorted.
+func sortedUserIDs(posts map[string][]*model.Post) []string {
+	userIDs := make([]string, 0, len(posts))
+	for userID := range posts {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+	return userIDs
+}
+
+// cancelDeferredPosts removes the pending deferred posts with the given ids,
+// including the ones waiting for users to be online and the ones held during
+// quiet hours, and returns how many were removed.
+func (p *Plugin) cancelDeferredPosts(ids []string) int {
+	deferred, waiting, held := 0, 0, 0
+	for _, id := range ids {
+		if p.removeDeferredPost(id) != nil {
+			deferred++
+		} else if p.removeWaitingForOnlinePost(id) != nil {
+			waiting++
+		} else if p.removeHeldPost(id) != nil {
+			held++
+		}
+	}
+	if deferred > 0 {
+		p.SaveDeferredPosts()
+	}
+	if waiting > 0 {
+		p.SaveWaitingForOnlinePosts()
+	}
+	return deferred + waiting + held
+}
+
+// describeDeferredPostsReport formats the report as a markdown table.
+func (p *Plugin) describeDeferredPostsReport(report *DeferredPostsReport) string {
+	if report.Total == 0 {
+		return "There are no pending deferred posts."
+	}
+	names := map[string]string{}
+	username := func(userID string) string {
+		if _, ok := names[userID]; !ok {
+			names[userID] = userID
+			if user, appErr := p.API.GetUser(userID); appErr == nil {
+				names[userID] = "@" + user.Username
+			}
+		}
+		return names[userID]
+	}
+	channelNames := map[string]string{}
+	channelName := func(channelID string) string {
+		if _, ok := channelNames[channelID]; !ok {
+			channelNames[channelID] = channelID
+			if channel, appErr := p.API.GetChannel(channelID); appErr == nil && channel.Type != model.CHANNEL_DIRECT && channel.Type != model.CHANNEL_GROUP {
+				channelNames[channelID] = "~" + channel.Name
+			}
+		}
+		return channelNames[channelID]
+	}
+
+	text := fmt.Sprintf("%d pending deferred posts, %d waiting for users to be online and %d held during quiet hours.\n\n", report.Total, report.WaitingForOnline, report.Held)
+	text += "| Id | Author | Channel | Send | Content |\n|---|---|---|---|---|\n"
+	for _, summary := range report.Posts {
+		author := username(summary.UserID)
+		if summary.UserDeactivated {
+			author += " (deactivated)"
+		}
+		send := time.Unix(0, summary.SendAt*int64(time.Millisecond)).UTC().Format("2006-01-02 15:04 MST")
+		if summary.Kind != deferredPostKindTime {
+			recipient := username(summary.WaitingForID)
+			if summary.WaitingForDeactivated {
+				recipient += " (deactivated)"
+			}
+			send = "when " + recipient + " is online"
+			if summary.Kind == deferredPostKindHeld {
+				send = "after the quiet hours of " + recipient
+			}
+		}
+		content := "(redacted)"
+		if summary.Message != "" {
+			content = previewMessage(summary.Message)
+		}
+		if summary.Files > 0 {
+			content += fmt.Sprintf(" (%d files)", summary.Files)
+		}
+		text += fmt.Sprintf("| %s | %s | %s | %s | %s |\n", summary.ID, author, channelName(summary.ChannelID), send, strings.Replace(content, "|", "\\|", -1))
+	}
+	return text
+}
+
+// describeOrphanedQueues formats the queues whose author was deactivated.
+func (p *Plugin) describeOrphanedQueues(queues []*Queue) string {
+	if len(queues) == 0 {
+		return "There are no queues of deactivated users."
+	}
+	lines := []string{"#### Queues of deactivated users:"}
+	for _, queue := range queues {
+		status := "active"
+		if queue.Paused {
+			status = "paused"
+		}
+		lines = append(lines, fmt.Sprintf(" * **%s** (%s, %d pending messages)", queue.Name, status, len(queue.Messages)))
+	}
+	return strings.Join(lines, "\n")
+}
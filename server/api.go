@@ -0,0 +1,650 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// maxImportFileSize limits the size of the files uploaded, or attached to
+// posts, to import messages.
+const maxImportFileSize = 10 * 1024 * 1024
+
+// serveAPI handles the requests to the plugin REST API, under /api/v1.
+func (p *Plugin) serveAPI(w http.ResponseWriter, r *http.Request, path []string) {
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		writeAPIError(w, http.StatusUnauthorized, "not authorized")
+		return
+	}
+
+	switch {
+	case len(path) == 3 && path[0] == "queues" && path[2] == "import" && r.Method == http.MethodPost:
+		p.handleImportQueueMessages(w, r, userID, path[1])
+	case len(path) == 1 && path[0] == "config" && r.Method == http.MethodGet:
+		p.handleGetConfig(w, r, userID)
+	case len(path) == 2 && path[0] == "autocomplete" && path[1] == "queues" && r.Method == http.MethodGet:
+		p.handleAutocompleteQueues(w, r, userID)
+	case len(path) == 2 && path[0] == "autocomplete" && path[1] == "messages" && r.Method == http.MethodGet:
+		p.handleAutocompleteMessages(w, r, userID)
+	case len(path) == 1 && path[0] == "queues" && r.Method == http.MethodGet:
+		p.handleListQueues(w, r, userID)
+	case len(path) == 2 && path[0] == "queues" && r.Method == http.MethodGet:
+		p.handleGetQueue(w, r, userID, path[1])
+	case len(path) == 3 && path[0] == "queues" && (path[2] == "pause" || path[2] == "resume") && r.Method == http.MethodPost:
+		p.handlePauseQueue(w, r, userID, path[1], path[2] == "pause")
+	case len(path) == 3 && path[0] == "queues" && path[2] == "schedule" && r.Method == http.MethodPut:
+		p.handleSetQueueSchedule(w, r, userID, path[1])
+	case len(path) == 3 && path[0] == "queues" && path[2] == "messages" && r.Method == http.MethodPost:
+		p.handleAddQueueMessage(w, r, userID, path[1])
+	case len(path) == 3 && path[0] == "queues" && path[2] == "messages" && r.Method == http.MethodPut:
+		p.handleReorderQueueMessages(w, r, userID, path[1])
+	case len(path) == 4 && path[0] == "queues" && path[2] == "messages" && r.Method == http.MethodPut:
+		p.handleEditQueueMessage(w, r, userID, path[1], path[3])
+	case len(path) == 4 && path[0] == "queues" && path[2] == "messages" && r.Method == http.MethodDelete:
+		p.handleDeleteQueueMessage(w, r, userID, path[1], path[3])
+	case len(path) == 3 && path[0] == "queues" && path[2] == "posts" && r.Method == http.MethodPost:
+		p.handleAddPostToQueue(w, r, userID, path[1])
+	case len(path) == 1 && path[0] == "deferred" && r.Method == http.MethodPost:
+		p.handleDeferPostCopy(w, r, userID)
+	case len(path) == 1 && path[0] == "export" && r.Method == http.MethodGet:
+		p.handleExportQueues(w, r, userID)
+	case len(path) == 2 && path[0] == "admin" && path[1] == "deferred" && r.Method == http.MethodGet:
+		p.handleAdminListDeferredPosts(w, r, userID)
+	case len(path) == 2 && path[0] == "admin" && path[1] == "orphaned" && r.Method == http.MethodGet:
+		p.handleAdminListOrphaned(w, r, userID)
+	case len(path) == 2 && path[0] == "admin" && path[1] == "deferred" && r.Method == http.MethodDelete:
+		p.handleAdminCancelDeferredPosts(w, r, userID, "")
+	case len(path) == 3 && path[0] == "admin" && path[1] == "deferred" && r.Method == http.MethodDelete:
+		p.handleAdminCancelDeferredPosts(w, r, userID, path[2])
+	default:
+		writeAPIError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// handleImportQueueMessages imports messages into a queue from the file
+// uploaded in the "file" field of a multipart form, or sent as request body.
+// The format is taken from the "format" query parameter, or from the file
+// extension. Unless the "dry_run" query parameter is false, the messages are
+// only parsed and returned without changing the queue. The file is read
+// before taking the state lock, so slow uploads don't block the plugin.
+func (p *Plugin) handleImportQueueMessages(w http.ResponseWriter, r *http.Request, userID string, queueName string) {
+	format := r.URL.Query().Get("format")
+	var data []byte
+	var err error
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportFileSize)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, header, fileErr := r.FormFile("file")
+		if fileErr != nil {
+			writeAPIError(w, http.StatusBadRequest, "missing file")
+			return
+		}
+		defer file.Close()
+		if format == "" {
+			format = importFormatFromFilename(header.Filename)
+		}
+		data, err = ioutil.ReadAll(file)
+	} else {
+		data, err = ioutil.ReadAll(r.Body)
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "unable to read the file")
+		return
+	}
+
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	queue, ok := p.getAPIQueue(w, userID, queueName)
+	if !ok {
+		return
+	}
+
+	messages, err := parseImport(data, format, queue.Name)
+	if err == nil {
+		err = p.checkImportedPayloads(userID, messages)
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := p.checkQueueLength(queue, len(messages)); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dryRun := r.URL.Query().Get("dry_run") != "false"
+	if !dryRun {
+		p.importQueueMessages(queue, messages, userID)
+		nErr := p.SaveQueues()
+		if nErr != nil {
+			p.API.LogError(nErr.Error())
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"dry_run":  dryRun,
+		"count":    len(messages),
+		"messages": messages,
+	})
+}
+
+// handleGetConfig returns the settings that the webapp needs.
+func (p *Plugin) handleGetConfig(w http.ResponseWriter, r *http.Request, userID string) {
+	config := p.getConfiguration()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"queue_managers":         config.QueueManagers,
+		"enable_online_deferral": config.EnableOnlineDeferral,
+	})
+}
+
+// getAPIQueue returns the queue with the given name, checking that the user
+// can manage it. If not, the error response is written.
+func (p *Plugin) getAPIQueue(w http.ResponseWriter, userID string, queueName string) (*Queue, bool) {
+	queue, ok := p.Queues[queueName]
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "unknown queue "+queueName)
+		return nil, false
+	}
+	if !p.canManageQueues(userID, queue.ChannelId) {
+		writeAPIError(w, http.StatusForbidden, "not allowed to handle the messages queue "+queueName)
+		return nil, false
+	}
+	return queue, true
+}
+
+// QueueSummary is the information of a queue returned by the REST API.
+type QueueSummary struct {
+	Name          string `json:"name"`
+	ChannelID     string `json:"channel_id"`
+	Schedule      string `json:"schedule"`
+	Timezone      string `json:"timezone"`
+	Pending       int    `json:"pending"`
+	NextExecution int64  `json:"next_execution,omitempty"`
+	Archived      bool   `json:"archived,omitempty"`
+	Paused        bool   `json:"paused,omitempty"`
+	Lifecycle     string `json:"lifecycle,omitempty"`
+}
+
+// QueueDetails is the information of a queue, with its messages, returned by
+// the REST API.
+type QueueDetails struct {
+	*QueueSummary
+	Messages []*QueueMessage `json:"messages"`
+}
+
+func (p *Plugin) newQueueSummary(queue *Queue) *QueueSummary {
+	summary := &QueueSummary{
+		Name:      queue.Name,
+		ChannelID: queue.ChannelId,
+		Schedule:  queue.SpecSource,
+		Timezone:  queue.Location().String(),
+		Pending:   len(queue.Messages),
+		Archived:  queue.Archived,
+		Paused:    queue.Paused,
+		Lifecycle: p.describeQueueLifecycle(queue),
+	}
+	if next := p.nextQueueExecution(queue, time.Now()); !next.IsZero() && queue.CompletedAt == 0 && !queue.Paused {
+		summary.NextExecution = model.GetMillisForTime(next)
+	}
+	return summary
+}
+
+// handleListQueues returns the queues sorted by name, only the ones of the
+// channel in the "channel_id" query parameter if it's set.
+func (p *Plugin) handleListQueues(w http.ResponseWriter, r *http.Request, userID string) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	channelID := r.URL.Query().Get("channel_id")
+	queues := []*QueueSummary{}
+	for _, queue := range p.manageableQueues(userID) {
+		if channelID == "" || queue.ChannelId == channelID {
+			queues = append(queues, p.newQueueSummary(queue))
+		}
+	}
+	sort.Slice(queues, func(i, j int) bool {
+		return queues[i].Name < queues[j].Name
+	})
+	writeJSON(w, http.StatusOK, queues)
+}
+
+// handleGetQueue returns the queue with its pending messages.
+func (p *Plugin) handleGetQueue(w http.ResponseWriter, r *http.Request, userID string, queueName string) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	queue, ok := p.getAPIQueue(w, userID, queueName)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, p.newQueueDetails(queue))
+}
+
+func (p *Plugin) newQueueDetails(queue *Queue) *QueueDetails {
+	messages := queue.Messages
+	if messages == nil {
+		messages = []*QueueMessage{}
+	}
+	return &QueueDetails{QueueSummary: p.newQueueSummary(queue), Messages: messages}
+}
+
+// handlePauseQueue pauses or resumes the queue.
+func (p *Plugin) handlePauseQueue(w http.ResponseWriter, r *http.Request, userID string, queueName string, paused bool) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	queue, ok := p.getAPIQueue(w, userID, queueName)
+	if !ok {
+		return
+	}
+	if !paused && !queue.Schedulable() {
+		writeAPIError(w, http.StatusBadRequest, "the queue has an invalid schedule, change it before resuming the queue")
+		return
+	}
+	p.setQueuePaused(queue, paused)
+	writeJSON(w, http.StatusOK, p.newQueueDetails(queue))
+}
+
+// handleSetQueueSchedule changes the schedule of the queue to the one in the
+// "schedule" field of the JSON body.
+func (p *Plugin) handleSetQueueSchedule(w http.ResponseWriter, r *http.Request, userID string, queueName string) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	queue, ok := p.getAPIQueue(w, userID, queueName)
+	if !ok {
+		return
+	}
+	var request struct {
+		Schedule string `json:"schedule"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+	if err := p.setQueueSchedule(queue, strings.TrimSpace(request.Schedule)); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	queue.CompletedAt = 0
+	queue.Archived = false
+	p.scheduleQueue(queue)
+	p.saveQueuesAndReply(w, queue)
+}
+
+// queueMessageRequest is the body of the requests that add or change a queue
+// message.
+type queueMessageRequest struct {
+	Message string `json:"message"`
+}
+
+func readQueueMessageRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	request := &queueMessageRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil || strings.TrimSpace(request.Message) == "" {
+		writeAPIError(w, http.StatusBadRequest, "invalid request, a message is required")
+		return "", false
+	}
+	if err := validateMessageTemplate(request.Message, true); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+	return request.Message, true
+}
+
+// handleAddQueueMessage adds the message at the end of the queue.
+func (p *Plugin) handleAddQueueMessage(w http.ResponseWriter, r *http.Request, userID string, queueName string) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	queue, ok := p.getAPIQueue(w, userID, queueName)
+	if !ok {
+		return
+	}
+	if err := p.checkQueueLength(queue, 1); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	text, ok := readQueueMessageRequest(w, r)
+	if !ok {
+		return
+	}
+	queue.Messages = append(queue.Messages, queue.NewMessage(text, userID))
+	p.checkQueueLowWater(queue)
+	p.saveQueuesAndReply(w, queue)
+}
+
+// handleEditQueueMessage changes the text of a pending message.
+func (p *Plugin) handleEditQueueMessage(w http.ResponseWriter, r *http.Request, userID string, queueName string, messageID string) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	queue, ok := p.getAPIQueue(w, userID, queueName)
+	if !ok {
+		return
+	}
+	idx, ok := queue.messageIndexByID(messageID)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "unknown message "+messageID)
+		return
+	}
+	text, ok := readQueueMessageRequest(w, r)
+	if !ok {
+		return
+	}
+	queue.Messages[idx].Message = text
+	p.saveQueuesAndReply(w, queue)
+}
+
+// handleDeleteQueueMessage removes a pending message from the queue.
+func (p *Plugin) handleDeleteQueueMessage(w http.ResponseWriter, r *http.Request, userID string, queueName string, messageID string) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	queue, ok := p.getAPIQueue(w, userID, queueName)
+	if !ok {
+		return
+	}
+	idx, ok := queue.messageIndexByID(messageID)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "unknown message "+messageID)
+		return
+	}
+	queue.Messages = append(queue.Messages[:idx], queue.Messages[idx+1:]...)
+	p.checkQueueLowWater(queue)
+	p.saveQueuesAndReply(w, queue)
+}
+
+// handleReorderQueueMessages sorts the pending messages in the order of the
+// "ids" field of the JSON body.
+func (p *Plugin) handleReorderQueueMessages(w http.ResponseWriter, r *http.Request, userID string, queueName string) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	queue, ok := p.getAPIQueue(w, userID, queueName)
+	if !ok {
+		return
+	}
+	var request struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+	if err := queue.ReorderMessages(request.IDs); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	p.saveQueuesAndReply(w, queue)
+}
+
+// saveQueuesAndReply saves the queues, and replies with the changed queue.
+func (p *Plugin) saveQueuesAndReply(w http.ResponseWriter, queue *Queue) {
+	nErr := p.SaveQueues()
+	if nErr != nil {
+		p.API.LogError(nErr.Error())
+	}
+	writeJSON(w, http.StatusOK, p.newQueueDetails(queue))
+}
+
+// postCopyRequest is the body of the requests that copy a post.
+type postCopyRequest struct {
+	PostID string `json:"post_id"`
+	// Delay is the time to wait before sending the copy, like 2h, or
+	// "online" to send it when the other user of a DM is online.
+	Delay string `json:"delay,omitempty"`
+	// SendAt is the time, in milliseconds, to send the copy, if Delay is
+	// not set.
+	SendAt int64 `json:"send_at,omitempty"`
+	// MaxWait and Fallback override the configuration defaults for the
+	// posts waiting for the user to be online.
+	MaxWait  string `json:"max_wait,omitempty"`
+	Fallback string `json:"fallback,omitempty"`
+}
+
+func readPostCopyRequest(w http.ResponseWriter, r *http.Request) (*postCopyRequest, bool) {
+	request := &postCopyRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil || !model.IsValidId(request.PostID) {
+		writeAPIError(w, http.StatusBadRequest, "invalid request, a post_id is required")
+		return nil, false
+	}
+	return request, true
+}
+
+// handleAddPostToQueue adds a copy of a post, with its files, at the end of
+// the queue.
+func (p *Plugin) handleAddPostToQueue(w http.ResponseWriter, r *http.Request, userID string, queueName string) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	queue, ok := p.getAPIQueue(w, userID, queueName)
+	if !ok {
+		return
+	}
+	if err := p.checkQueueLength(queue, 1); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	request, ok := readPostCopyRequest(w, r)
+	if !ok {
+		return
+	}
+	payload, err := p.copyPostPayload(userID, request.PostID)
+	if err == nil {
+		err = validateMessageTemplate(payload.Message, true)
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	message := queue.NewMessage(payload.Message, userID)
+	message.Props = payload.GetProps()
+	message.FileIds = payload.FileIds
+	queue.Messages = append(queue.Messages, message)
+	p.checkQueueLowWater(queue)
+	nErr := p.SaveQueues()
+	if nErr != nil {
+		p.API.LogError(nErr.Error())
+	}
+	writeJSON(w, http.StatusOK, message)
+}
+
+// handleDeferPostCopy sends a copy of a post, with its files, later in the
+// same channel and thread.
+func (p *Plugin) handleDeferPostCopy(w http.ResponseWriter, r *http.Request, userID string) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	request, ok := readPostCopyRequest(w, r)
+	if !ok {
+		return
+	}
+	var duration time.Duration
+	options := &onlineDeferral{}
+	if request.MaxWait != "" {
+		if err := options.Set("max-wait", request.MaxWait); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if request.Fallback != "" {
+		if err := options.Set("fallback", request.Fallback); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if request.Delay != "online" {
+		var err error
+		duration, err = time.ParseDuration(request.Delay)
+		if request.Delay == "" {
+			duration, err = time.Until(millisToTime(request.SendAt)), nil
+		}
+		if err != nil || duration <= 0 {
+			writeAPIError(w, http.StatusBadRequest, "invalid delay or send time")
+			return
+		}
+	}
+
+	original, appErr := p.API.GetPost(request.PostID)
+	if appErr != nil {
+		writeAPIError(w, http.StatusNotFound, "unable to get the post")
+		return
+	}
+	if !p.API.HasPermissionToChannel(userID, original.ChannelId, model.PERMISSION_CREATE_POST) {
+		writeAPIError(w, http.StatusForbidden, "not allowed to post in the channel")
+		return
+	}
+	payload, err := p.copyPostPayload(userID, request.PostID)
+	if err == nil {
+		err = validateMessageTemplate(payload.Message, false)
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	post := payload.Clone()
+	post.UserId = userID
+	post.ChannelId = original.ChannelId
+	post.RootId = original.RootId
+	post.ParentId = original.ParentId
+	if request.Delay == "online" {
+		err = p.deferPostUntilOnline(post, options)
+	} else {
+		err = p.deferPost(post, duration)
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// handleExportQueues downloads the export of the queue in the "queue" query
+// parameter, or of all the queues if it's not set, in the format of the
+// "format" query parameter.
+func (p *Plugin) handleExportQueues(w http.ResponseWriter, r *http.Request, userID string) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	queues := p.manageableQueues(userID)
+	if queueName := r.URL.Query().Get("queue"); queueName != "" {
+		queue, ok := p.getAPIQueue(w, userID, queueName)
+		if !ok {
+			return
+		}
+		queues = []*Queue{queue}
+	}
+
+	data, filename, err := exportQueues(queues, r.URL.Query().Get("format"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	contentType := "application/json"
+	if strings.HasSuffix(filename, ".md") {
+		contentType = "text/markdown; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	_, _ = w.Write(data)
+}
+
+// handleAdminListDeferredPosts returns the report of the pending deferred
+// posts, filtered by the "user_id", "channel_id" and "orphaned" query
+// parameters. The messages are only included if the "content" query parameter
+// is true.
+func (p *Plugin) handleAdminListDeferredPosts(w http.ResponseWriter, r *http.Request, userID string) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	if !p.isSystemAdmin(userID) {
+		writeAPIError(w, http.StatusForbidden, "only the system admins can list the deferred posts")
+		return
+	}
+	query := r.URL.Query()
+	writeJSON(w, http.StatusOK, p.deferredPostsReport(&deferredPostsFilter{
+		UserID:      query.Get("user_id"),
+		ChannelID:   query.Get("channel_id"),
+		Orphaned:    query.Get("orphaned") == "true",
+		ShowContent: query.Get("content") == "true",
+	}))
+}
+
+// handleAdminListOrphaned returns the deferred posts and the queues of the
+// deactivated users, and the posts waiting for them to be online.
+func (p *Plugin) handleAdminListOrphaned(w http.ResponseWriter, r *http.Request, userID string) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	if !p.isSystemAdmin(userID) {
+		writeAPIError(w, http.StatusForbidden, "only the system admins can list the orphaned content")
+		return
+	}
+	queues := []*QueueSummary{}
+	for _, queue := range p.orphanedQueues() {
+		queues = append(queues, p.newQueueSummary(queue))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"deferred": p.deferredPostsReport(&deferredPostsFilter{
+			Orphaned:    true,
+			ShowContent: r.URL.Query().Get("content") == "true",
+		}),
+		"queues": queues,
+	})
+}
+
+// handleAdminCancelDeferredPosts cancels the pending deferred post with the
+// given id or, without id, all the ones matching the "user_id", "channel_id"
+// and "orphaned" query parameters.
+func (p *Plugin) handleAdminCancelDeferredPosts(w http.ResponseWriter, r *http.Request, userID string, postID string) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	if !p.isSystemAdmin(userID) {
+		writeAPIError(w, http.StatusForbidden, "only the system admins can cancel the deferred posts")
+		return
+	}
+	ids := []string{postID}
+	if postID == "" {
+		query := r.URL.Query()
+		filter := &deferredPostsFilter{
+			UserID:    query.Get("user_id"),
+			ChannelID: query.Get("channel_id"),
+			Orphaned:  query.Get("orphaned") == "true",
+		}
+		if filter.UserID == "" && filter.ChannelID == "" && !filter.Orphaned {
+			writeAPIError(w, http.StatusBadRequest, "missing user_id, channel_id or orphaned")
+			return
+		}
+		ids = []string{}
+		for _, summary := range p.deferredPostsReport(filter).Posts {
+			ids = append(ids, summary.ID)
+		}
+	}
+	cancelled := p.cancelDeferredPosts(ids)
+	if postID != "" && cancelled == 0 {
+		writeAPIError(w, http.StatusNotFound, "unknown deferred post "+postID)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"cancelled": cancelled})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		return
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, model.NewAppError("ServeHTTP", "", nil, message, status))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newPostMenuTestPlugin returns a plugin with the queue tips and the post to
+// copy, with a file and a prop set by the server, readable by user1.
+func newPostMenuTestPlugin(t *testing.T) (*Plugin, *plugintest.API, *model.Post) {
+	post := &model.Post{Id: model.NewId(), ChannelId: "channel1", RootId: "root1", Message: "Copy me", FileIds: []string{"file1"}}
+	post.AddProp("from_webhook", "true")
+	post.AddProp("attachments", "kept")
+
+	api := &plugintest.API{}
+	api.On("GetPost", post.Id).Return(post, nil)
+	api.On("HasPermissionToChannel", "user1", "channel1", model.PERMISSION_READ_CHANNEL).Return(true)
+	api.On("CopyFileInfos", "user1", []string{"file1"}).Return([]string{"copy1"}, nil)
+	api.On("KVSet", mock.Anything, mock.Anything).Return(nil)
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.Queues = map[string]*Queue{"tips": {Name: "tips", UserId: "user1", ChannelId: "channel2"}}
+	return p, api, post
+}
+
+func servePostMenuRequest(p *Plugin, userID string, path []string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/"+strings.Join(path, "/"), strings.NewReader(body))
+	r.Header.Set("Mattermost-User-ID", userID)
+	p.serveAPI(w, r, path)
+	return w
+}
+
+func TestHandleAddPostToQueue(t *testing.T) {
+	p, api, post := newPostMenuTestPlugin(t)
+	api.On("HasPermissionTo", "user1", model.PERMISSION_MANAGE_SYSTEM).Return(true)
+	api.On("HasPermissionTo", "user2", model.PERMISSION_MANAGE_SYSTEM).Return(false)
+
+	w := servePostMenuRequest(p, "user2", []string{"queues", "tips", "posts"}, `{"post_id":"`+post.Id+`"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = servePostMenuRequest(p, "user1", []string{"queues", "unknown", "posts"}, `{"post_id":"`+post.Id+`"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = servePostMenuRequest(p, "user1", []string{"queues", "tips", "posts"}, `{"post_id":"invalid"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = servePostMenuRequest(p, "user1", []string{"queues", "tips", "posts"}, `{"post_id":"`+post.Id+`"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	messages := p.Queues["tips"].Messages
+	require.Len(t, messages, 1)
+	assert.Equal(t, "Copy me", messages[0].Message)
+	assert.Equal(t, "user1", messages[0].CreatedBy)
+	assert.Equal(t, []string{"copy1"}, messages[0].FileIds)
+	assert.Equal(t, model.StringInterface{"attachments": "kept"}, messages[0].Props)
+}
+
+func TestHandleDeferPostCopy(t *testing.T) {
+	p, api, post := newPostMenuTestPlugin(t)
+	api.On("HasPermissionToChannel", "user1", "channel1", model.PERMISSION_CREATE_POST).Return(true)
+	api.On("HasPermissionToChannel", "user2", "channel1", model.PERMISSION_CREATE_POST).Return(false)
+	api.On("HasPermissionTo", "user1", model.PERMISSION_MANAGE_SYSTEM).Return(false)
+
+	w := servePostMenuRequest(p, "user2", []string{"deferred"}, `{"post_id":"`+post.Id+`","delay":"2h"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = servePostMenuRequest(p, "user1", []string{"deferred"}, `{"post_id":"`+post.Id+`","delay":"later"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = servePostMenuRequest(p, "user1", []string{"deferred"}, `{"post_id":"`+post.Id+`","send_at":1000}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, p.deferredPosts)
+
+	w = servePostMenuRequest(p, "user1", []string{"deferred"}, `{"post_id":"`+post.Id+`","delay":"2h"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, p.deferredPosts, 1)
+	deferred := p.deferredPosts[0].Post
+	assert.Equal(t, "user1", deferred.UserId)
+	assert.Equal(t, "channel1", deferred.ChannelId)
+	assert.Equal(t, "root1", deferred.RootId)
+	assert.Equal(t, "Copy me", deferred.Message)
+	assert.Equal(t, model.StringArray{"copy1"}, deferred.FileIds)
+	assert.Nil(t, deferred.GetProp("from_webhook"))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// commandArgument is an argument of a slash command, with its position in the
+// original command text.
+type commandArgument struct {
+	Value string
+	Start int
+	End   int
+}
+
+// parsedCommand is a slash command split in arguments. The arguments are
+// separated by spaces, and can be quoted with single or double quotes to
+// include spaces on them. The original text is kept, so the message bodies
+// can be extracted from it without changes.
+type parsedCommand struct {
+	Text      string
+	Arguments []commandArgument
+}
+
+// parseCommand splits the command in arguments. Unterminated quotes are not
+// an error, the quote and the rest of the text are taken literally, so
+// apostrophes in messages are safe.
+func parseCommand(text string) *parsedCommand {
+	command := &parsedCommand{Text: text}
+	runes := []rune(text)
+	offsets := make([]int, len(runes)+1)
+	offset := 0
+	for idx, r := range runes {
+		offsets[idx] = offset
+		offset += len(string(r))
+	}
+	offsets[len(runes)] = offset
+
+	for idx := 0; idx < len(runes); {
+		if unicode.IsSpace(runes[idx]) {
+			idx++
+			continue
+		}
+		start := idx
+		if quote := runes[idx]; quote == '"' || quote == '\'' {
+			if value, end, ok := parseQuotedArgument(runes, idx); ok {
+				command.Arguments = append(command.Arguments, commandArgument{Value: value, Start: offsets[start], End: offsets[end]})
+				idx = end
+				continue
+			}
+		}
+		for idx < len(runes) && !unicode.IsSpace(runes[idx]) {
+			idx++
+		}
+		command.Arguments = append(command.Arguments, commandArgument{Value: string(runes[start:idx]), Start: offsets[start], End: offsets[idx]})
+	}
+	return command
+}
+
+// parseQuotedArgument reads the quoted argument starting at start, and returns
+// its value and the position after the closing quote. Inside double quotes a
+// backslash escapes the next character. The closing quote must be followed by
+// a space or the end of the command.
+func parseQuotedArgument(runes []rune, start int) (string, int, bool) {
+	quote := runes[start]
+	value := []rune{}
+	for idx := start + 1; idx < len(runes); idx++ {
+		switch {
+		case quote == '"' && runes[idx] == '\\' && idx+1 < len(runes):
+			idx++
+			value = append(value, runes[idx])
+		case runes[idx] == quote:
+			if idx+1 < len(runes) && !unicode.IsSpace(runes[idx+1]) {
+				return "", 0, false
+			}
+			return string(value), idx + 1, true
+		default:
+			value = append(value, runes[idx])
+		}
+	}
+	return "", 0, false
+}
+
+// Values returns the values of the arguments.
+func (c *parsedCommand) Values() []string {
+	values := make([]string, len(c.Arguments))
+	for idx, argument := range c.Arguments {
+		values[idx] = argument.Value
+	}
+	return values
+}
+
+// Rest returns the original text of the command from the argument in the
+// given position, like the message of the commands. Only the space or the
+// line break that separates it from the previous argument is skipped, and the
+// rest of the text is kept as is, including indentation, line breaks,
+// repeated spaces and quotes.
+func (c *parsedCommand) Rest(position int) string {
+	if position >= len(c.Arguments) {
+		return ""
+	}
+	if position == 0 {
+		return c.Text[c.Arguments[0].Start:]
+	}
+	rest := c.Text[c.Arguments[position-1].End:]
+	for _, separator := range []string{"\r\n", "\n", " ", "\t"} {
+		if strings.HasPrefix(rest, separator) {
+			return rest[len(separator):]
+		}
+	}
+	return rest
+}
+
+// Flags returns the arguments from the given position that are flags, like
+// --confirm or --format=json, as a map from the flag name to its value.
+func (c *parsedCommand) Flags(position int) map[string]string {
+	flags := map[string]string{}
+	for idx := position; idx < len(c.Arguments); idx++ {
+		value := c.Arguments[idx].Value
+		if !isCommandFlag(value) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(value, "--"), "=", 2)
+		flags[parts[0]] = ""
+		if len(parts) == 2 {
+			flags[parts[0]] = parts[1]
+		}
+	}
+	return flags
+}
+
+// isCommandFlag returns true if the argument is a flag, like --confirm or
+// --format=json. Arguments like -- or --- are not flags.
+func isCommandFlag(value string) bool {
+	return len(value) > 2 && strings.HasPrefix(value, "--") && unicode.IsLetter([]rune(value[2:])[0])
+}
+
+// RestValue is like Rest, but if there is a single argument from the given
+// position its value is returned, so it can be quoted.
+func (c *parsedCommand) RestValue(position int) string {
+	if position == len(c.Arguments)-1 {
+		return c.Arguments[position].Value
+	}
+	return strings.TrimSpace(c.Rest(position))
+}
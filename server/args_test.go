@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCommand(t *testing.T) {
+	t.Run("arguments", func(t *testing.T) {
+		command := parseCommand(`/messages-queue  set "my queue" owners 'a b' "say \"hi\"" it's`)
+		assert.Equal(t, []string{"/messages-queue", "set", "my queue", "owners", "a b", `say "hi"`, "it's"}, command.Values())
+	})
+
+	t.Run("unterminated quotes", func(t *testing.T) {
+		command := parseCommand(`/defer-post 1h 'tis "the season`)
+		assert.Equal(t, []string{"/defer-post", "1h", "'tis", `"the`, "season"}, command.Values())
+	})
+
+	t.Run("rest keeps the text", func(t *testing.T) {
+		message := "# Release\n\n```\ncode  block\n```\n\n| a | b |\n|---|---|\n\"quoted\"  text"
+		command := parseCommand("/messages-queue add-message tips\n" + message)
+		assert.Equal(t, message, command.Rest(3))
+
+		command = parseCommand("/messages-queue add-message tips two  spaces")
+		assert.Equal(t, "two  spaces", command.Rest(3))
+		assert.Equal(t, "", command.Rest(5))
+
+		command = parseCommand("/messages-queue add-message tips     code\n  - nested")
+		assert.Equal(t, "    code\n  - nested", command.Rest(3))
+
+		command = parseCommand("/messages-queue add-message tips\r\n\tindented")
+		assert.Equal(t, "\tindented", command.Rest(3))
+	})
+
+	t.Run("rest value", func(t *testing.T) {
+		assert.Equal(t, "0 10 * * 1-5", parseCommand(`/messages-queue create tips "0 10 * * 1-5"`).RestValue(3))
+		assert.Equal(t, "0 10 * * 1-5", parseCommand(`/messages-queue create tips 0 10 * * 1-5 `).RestValue(3))
+	})
+
+	t.Run("flags", func(t *testing.T) {
+		flags := parseCommand("/messages-queue import tips link --confirm --format=csv").Flags(4)
+		assert.Equal(t, map[string]string{"confirm": "", "format": "csv"}, flags)
+
+		flags = parseCommand("/messages-queue import tips link --- -- --confirm").Flags(4)
+		assert.Equal(t, map[string]string{"confirm": ""}, flags)
+	})
+}
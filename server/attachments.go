@@ -0,0 +1,77 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// PostAttachment is a file attached to a post, with its content.
+type PostAttachment struct {
+	Info *model.FileInfo
+	Data []byte
+}
+
+// postIDFromReference extracts the post id from a post permalink or returns
+// the reference if it's already a post id.
+func postIDFromReference(ref string) (string, error) {
+	postID := path.Base(strings.TrimRight(strings.TrimSpace(ref), "/"))
+	if !model.IsValidId(postID) {
+		return "", errors.Errorf("invalid post link %s", ref)
+	}
+	return postID, nil
+}
+
+// getPostAttachments returns the files attached to the referenced post with
+// any of the given extensions, checking that the user can read the post and
+// that the files are not bigger than the import limit.
+func (p *Plugin) getPostAttachments(userID string, ref string, extensions ...string) ([]*PostAttachment, error) {
+	postID, err := postIDFromReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "unable to get the post")
+	}
+	if !p.API.HasPermissionToChannel(userID, post.ChannelId, model.PERMISSION_READ_CHANNEL) {
+		return nil, errors.New("unable to get the post")
+	}
+
+	attachments := []*PostAttachment{}
+	for _, fileID := range post.FileIds {
+		info, appErr := p.API.GetFileInfo(fileID)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "unable to get the file information")
+		}
+		if len(extensions) > 0 && !hasExtension(info.Extension, extensions) {
+			continue
+		}
+		if info.Size > maxImportFileSize {
+			return nil, errors.Errorf("the file %s is too big, the maximum size is %d MB", info.Name, maxImportFileSize/1024/1024)
+		}
+		data, appErr := p.API.GetFile(fileID)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "unable to get the file")
+		}
+		attachments = append(attachments, &PostAttachment{Info: info, Data: data})
+	}
+	if len(attachments) == 0 && len(extensions) > 0 {
+		return nil, errors.Errorf("the post doesn't have any %s file attached", strings.Join(extensions, "/"))
+	}
+	if len(attachments) == 0 {
+		return nil, errors.New("the post doesn't have any file attached")
+	}
+	return attachments, nil
+}
+
+func hasExtension(extension string, extensions []string) bool {
+	for _, ext := range extensions {
+		if strings.EqualFold(extension, ext) {
+			return true
+		}
+	}
+	return false
+}
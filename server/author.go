@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// checkPostAuthor returns an error if the user can't post in the channel
+// anymore, because it was deleted, deactivated or lost the permission.
+func (p *Plugin) checkPostAuthor(userID string, channelID string) error {
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		return errors.New("the author doesn't exist anymore")
+	}
+	if user.DeleteAt != 0 {
+		return errors.Errorf("@%s is deactivated", user.Username)
+	}
+	if !p.API.HasPermissionToChannel(userID, channelID, model.PERMISSION_CREATE_POST) {
+		return errors.Errorf("@%s can't post in the channel anymore", user.Username)
+	}
+	return nil
+}
+
+// deliveryAuthor returns the user that sends a post of the given author in
+// the channel. If the author can't post anymore, it's the plugin bot when
+// the configuration reassigns the posts, and otherwise an error. The posts
+// already reassigned to the bot are not checked.
+func (p *Plugin) deliveryAuthor(userID string, channelID string) (string, error) {
+	if userID == p.botUserID {
+		return userID, nil
+	}
+	err := p.checkPostAuthor(userID, channelID)
+	if err == nil {
+		return userID, nil
+	}
+	p.API.LogWarn("the author of a scheduled post can't post anymore", "user_id", userID, "channel_id", channelID, "err", err.Error())
+	if p.getConfiguration().InvalidAuthorPolicy == invalidAuthorPolicyReassign {
+		return p.botUserID, nil
+	}
+	return "", err
+}
+
+// onBehalfOf returns the note added to the posts reassigned to the bot.
+func (p *Plugin) onBehalfOf(userID string) string {
+	if user, appErr := p.API.GetUser(userID); appErr == nil {
+		return fmt.Sprintf("_Sent on behalf of @%s_", user.Username)
+	}
+	return "_Sent on behalf of a former user_"
+}
+
+// pauseQueueForAuthor pauses the queue because its author can't post
+// anymore, and notifies the queue owners.
+func (p *Plugin) pauseQueueForAuthor(queue *Queue, err error) {
+	p.setQueuePaused(queue, true)
+	message := fmt.Sprintf("The queue %s was paused because %s. Resume it with `/%s resume %s` when the author can post again.", queue.Name, err.Error(), queueCommand, queue.Name)
+	for _, userID := range queue.Owners() {
+		p.notifyUser(userID, message)
+	}
+}
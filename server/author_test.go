@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newAuthorTestPlugin returns a plugin with the author alice, who can post in
+// channel1 but not in channel2, and the deactivated author bob.
+func newAuthorTestPlugin(t *testing.T) (*Plugin, *plugintest.API) {
+	api := &plugintest.API{}
+	api.On("GetUser", "alice").Return(&model.User{Id: "alice", Username: "alice"}, nil)
+	api.On("GetUser", "bob").Return(&model.User{Id: "bob", Username: "bob", DeleteAt: 1}, nil)
+	api.On("GetUser", "unknown").Return(nil, model.NewAppError("GetUser", "", nil, "not found", 404))
+	api.On("HasPermissionToChannel", "alice", "channel1", model.PERMISSION_CREATE_POST).Return(true)
+	api.On("HasPermissionToChannel", "alice", "channel2", model.PERMISSION_CREATE_POST).Return(false)
+	api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+	p := &Plugin{botUserID: "bot"}
+	p.SetAPI(api)
+	return p, api
+}
+
+func TestDeliveryAuthor(t *testing.T) {
+	p, _ := newAuthorTestPlugin(t)
+
+	authorID, err := p.deliveryAuthor("alice", "channel1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", authorID)
+
+	_, err = p.deliveryAuthor("alice", "channel2")
+	assert.EqualError(t, err, "@alice can't post in the channel anymore")
+	_, err = p.deliveryAuthor("bob", "channel1")
+	assert.EqualError(t, err, "@bob is deactivated")
+	_, err = p.deliveryAuthor("unknown", "channel1")
+	assert.EqualError(t, err, "the author doesn't exist anymore")
+
+	p.setConfiguration(&configuration{InvalidAuthorPolicy: invalidAuthorPolicyReassign})
+	authorID, err = p.deliveryAuthor("bob", "channel1")
+	require.NoError(t, err)
+	assert.Equal(t, "bot", authorID)
+	authorID, err = p.deliveryAuthor("alice", "channel1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", authorID)
+}
+
+func TestPauseQueueForAuthor(t *testing.T) {
+	p, api := newAuthorTestPlugin(t)
+	api.On("KVSet", "queues", mock.Anything).Return(nil)
+	api.On("GetDirectChannel", mock.Anything, "bot").Return(func(userID string, botID string) *model.Channel {
+		return &model.Channel{Id: "dm-" + userID}
+	}, nil)
+	api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+
+	queue := &Queue{Name: "tips", UserId: "bob", OwnerIds: []string{"bob", "carol"}, ChannelId: "channel1"}
+	p.Queues = map[string]*Queue{"tips": queue}
+	p.pauseQueueForAuthor(queue, errors.New("@bob is deactivated"))
+
+	assert.True(t, queue.Paused)
+	assert.Nil(t, queue.task)
+	api.AssertCalled(t, "KVSet", "queues", mock.Anything)
+	for _, userID := range []string{"bob", "carol"} {
+		api.AssertCalled(t, "CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.UserId == "bot" && post.ChannelId == "dm-"+userID &&
+				post.Message == "The queue tips was paused because @bob is deactivated. Resume it with `/messages-queue resume tips` when the author can post again."
+		}))
+	}
+}
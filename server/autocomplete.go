@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// URLs of the dynamic autocomplete lists, relative to the plugin URL.
+const (
+	autocompleteQueuesURL   = "api/v1/autocomplete/queues"
+	autocompleteMessagesURL = "api/v1/autocomplete/messages"
+)
+
+// handleAutocompleteQueues returns the names of the queues the user can
+// manage, with the queues of the current channel first.
+func (p *Plugin) handleAutocompleteQueues(w http.ResponseWriter, r *http.Request, userID string) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	items := []model.AutocompleteListItem{}
+	channelID := r.URL.Query().Get("channel_id")
+	queues := p.manageableQueues(userID)
+	sort.Slice(queues, func(i, j int) bool {
+		if (queues[i].ChannelId == channelID) != (queues[j].ChannelId == channelID) {
+			return queues[i].ChannelId == channelID
+		}
+		return queues[i].Name < queues[j].Name
+	})
+	for _, queue := range queues {
+		items = append(items, model.AutocompleteListItem{
+			Item:     queue.Name,
+			Hint:     queue.SpecSource,
+			HelpText: fmt.Sprintf("%d pending messages", len(queue.Messages)),
+		})
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// handleAutocompleteMessages returns the ids of the messages of the queue
+// already typed in the command, with their position and a preview.
+func (p *Plugin) handleAutocompleteMessages(w http.ResponseWriter, r *http.Request, userID string) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	items := []model.AutocompleteListItem{}
+	arguments := parseCommand(r.URL.Query().Get("parsed")).Values()
+	if len(arguments) < 3 {
+		writeJSON(w, http.StatusOK, items)
+		return
+	}
+
+	queue, ok := p.Queues[arguments[2]]
+	if !ok || !p.canManageQueues(userID, queue.ChannelId) {
+		writeJSON(w, http.StatusOK, items)
+		return
+	}
+	for position, message := range queue.Messages {
+		items = append(items, model.AutocompleteListItem{
+			Item:     message.ID,
+			Hint:     fmt.Sprintf("position %d", position),
+			HelpText: previewMessage(message.Message),
+		})
+	}
+	writeJSON(w, http.StatusOK, items)
+}
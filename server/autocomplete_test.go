@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleAutocompleteMessages(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("HasPermissionTo", "user1", model.PERMISSION_MANAGE_SYSTEM).Return(true)
+	api.On("HasPermissionTo", "user2", model.PERMISSION_MANAGE_SYSTEM).Return(false)
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	queue := &Queue{Name: "tips", UserId: "user1", ChannelId: "channel1"}
+	queue.Messages = []*QueueMessage{
+		queue.NewMessage("First tip\nwith details", "user1"),
+		queue.NewMessage("Second tip", "user1"),
+	}
+	p.Queues = map[string]*Queue{"tips": queue}
+
+	autocomplete := func(userID string, parsed string) []model.AutocompleteListItem {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/autocomplete/messages?parsed="+url.QueryEscape(parsed), nil)
+		r.Header.Set("Mattermost-User-ID", userID)
+		p.serveAPI(w, r, []string{"autocomplete", "messages"})
+		require.Equal(t, http.StatusOK, w.Code)
+		items := []model.AutocompleteListItem{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&items))
+		return items
+	}
+
+	items := autocomplete("user1", "/messages-queue remove-message tips ")
+	require.Len(t, items, 2)
+	assert.Equal(t, queue.Messages[0].ID, items[0].Item)
+	assert.Equal(t, "position 0", items[0].Hint)
+	assert.Equal(t, "First tip …", items[0].HelpText)
+	assert.Equal(t, queue.Messages[1].ID, items[1].Item)
+	assert.Equal(t, "position 1", items[1].Hint)
+	assert.Equal(t, "Second tip", items[1].HelpText)
+
+	assert.Empty(t, autocomplete("user1", `/messages-queue remove-message "unknown" `))
+	assert.Empty(t, autocomplete("user1", "/messages-queue remove-message "))
+	assert.Empty(t, autocomplete("user2", "/messages-queue remove-message tips "))
+}
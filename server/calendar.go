@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const calendarDateFormat = "2006-01-02"
+
+const (
+	blackoutPolicySkip     = "skip"
+	blackoutPolicyPostpone = "postpone"
+)
+
+// maxBlackoutLookahead limits how many blackout ranges we skip looking for a
+// date not included in the blackout calendars.
+const maxBlackoutLookahead = 1000
+
+// Calendar is a named list of blackout dates that queues can reference to
+// avoid sending messages on holidays or freeze periods.
+type Calendar struct {
+	Name   string       `json:"name"`
+	Ranges []*DateRange `json:"ranges"`
+}
+
+// DateRange is an inclusive range of dates in the calendarDateFormat format.
+type DateRange struct {
+	Start   string `json:"start"`
+	End     string `json:"end"`
+	Summary string `json:"summary,omitempty"`
+}
+
+func (r *DateRange) String() string {
+	text := r.Start
+	if r.End != r.Start {
+		text = r.Start + ".." + r.End
+	}
+	if r.Summary != "" {
+		text += " (" + r.Summary + ")"
+	}
+	return text
+}
+
+// parseDateRange parses a single date (2006-01-02) or a range of dates
+// (2006-01-02..2006-01-31).
+func parseDateRange(text string) (*DateRange, error) {
+	parts := strings.SplitN(text, "..", 2)
+	start, err := time.Parse(calendarDateFormat, parts[0])
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid date %s", parts[0])
+	}
+	end := start
+	if len(parts) == 2 {
+		end, err = time.Parse(calendarDateFormat, parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid date %s", parts[1])
+		}
+	}
+	if end.Before(start) {
+		return nil, errors.Errorf("the range %s ends before it starts", text)
+	}
+	return &DateRange{Start: start.Format(calendarDateFormat), End: end.Format(calendarDateFormat)}, nil
+}
+
+// Contains returns true if the date of t, in the location of t, is included
+// in the calendar.
+func (c *Calendar) Contains(t time.Time) bool {
+	date := t.Format(calendarDateFormat)
+	for _, r := range c.Ranges {
+		if r.Start <= date && date <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// AddRanges adds the ranges to the calendar, ignoring the ones already
+// present, and returns the number of added ranges.
+func (c *Calendar) AddRanges(ranges ...*DateRange) int {
+	added := 0
+	for _, newRange := range ranges {
+		exists := false
+		for _, r := range c.Ranges {
+			if r.Start == newRange.Start && r.End == newRange.End {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			c.Ranges = append(c.Ranges, newRange)
+			added++
+		}
+	}
+	sort.Slice(c.Ranges, func(i, j int) bool {
+		return c.Ranges[i].Start < c.Ranges[j].Start
+	})
+	return added
+}
+
+// RemoveRange removes the range from the calendar and returns false if the
+// range is not in the calendar.
+func (c *Calendar) RemoveRange(dateRange *DateRange) bool {
+	for idx, r := range c.Ranges {
+		if r.Start == dateRange.Start && r.End == dateRange.End {
+			c.Ranges = append(c.Ranges[:idx], c.Ranges[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// parseICS extracts the dates of the events of an iCalendar file. Recurring
+// events are not expanded, only their first occurrence is used.
+func parseICS(data []byte) ([]*DateRange, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	ranges := []*DateRange{}
+	var current *DateRange
+	for _, line := range lines {
+		nameAndParams, value := line, ""
+		if idx := strings.Index(line, ":"); idx >= 0 {
+			nameAndParams, value = line[:idx], line[idx+1:]
+		}
+		name := strings.ToUpper(strings.SplitN(nameAndParams, ";", 2)[0])
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			current = &DateRange{}
+		case name == "END" && value == "VEVENT":
+			if current == nil || current.Start == "" {
+				return nil, errors.New("event without start date")
+			}
+			if current.End == "" {
+				current.End = current.Start
+			}
+			if current.End < current.Start {
+				current.End = current.Start
+			}
+			ranges = append(ranges, current)
+			current = nil
+		case current != nil && name == "DTSTART":
+			date, _, err := parseICSDate(value)
+			if err != nil {
+				return nil, err
+			}
+			current.Start = date.Format(calendarDateFormat)
+		case current != nil && name == "DTEND":
+			date, isDate, err := parseICSDate(value)
+			if err != nil {
+				return nil, err
+			}
+			// The end of all-day events is not included in the event
+			if isDate {
+				date = date.AddDate(0, 0, -1)
+			}
+			current.End = date.Format(calendarDateFormat)
+		case current != nil && name == "SUMMARY":
+			current.Summary = strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\\`, `\`).Replace(value)
+		}
+	}
+	if len(ranges) == 0 {
+		return nil, errors.New("no events found in the calendar")
+	}
+	return ranges, nil
+}
+
+// parseICSDate parses DATE and DATE-TIME values, returning true if the value
+// is a DATE.
+func parseICSDate(value string) (time.Time, bool, error) {
+	if len(value) == len("20060102") {
+		date, err := time.Parse("20060102", value)
+		return date, true, errors.Wrapf(err, "invalid date %s", value)
+	}
+	date, err := time.Parse("20060102T150405", strings.TrimSuffix(value, "Z"))
+	return date, false, errors.Wrapf(err, "invalid date %s", value)
+}
+
+// blackoutCalendars returns the calendars referenced by the queue.
+func (p *Plugin) blackoutCalendars(queue *Queue) []*Calendar {
+	calendars := []*Calendar{}
+	for _, name := range queue.Calendars {
+		if calendar, ok := p.Calendars[name]; ok {
+			calendars = append(calendars, calendar)
+		}
+	}
+	return calendars
+}
+
+func isBlackout(t time.Time, calendars []*Calendar) bool {
+	for _, calendar := range calendars {
+		if calendar.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// blackoutEnd returns the start of the first day after the blackout dates
+// that include t, in the location of t, or the zero time if the date of t is
+// not a blackout date.
+func blackoutEnd(t time.Time, calendars []*Calendar) time.Time {
+	end := time.Time{}
+	for i := 0; i < maxBlackoutLookahead; i++ {
+		date := t.Format(calendarDateFormat)
+		last := ""
+		for _, calendar := range calendars {
+			for _, r := range calendar.Ranges {
+				if r.Start <= date && date <= r.End && r.End > last {
+					last = r.End
+				}
+			}
+		}
+		if last == "" {
+			return end
+		}
+		day := t
+		if lastDate, err := time.ParseInLocation(calendarDateFormat, last, t.Location()); err == nil {
+			day = lastDate
+		}
+		t = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, t.Location())
+		end = t
+	}
+	return end
+}
+
+func (p *Plugin) describeCalendars() string {
+	if len(p.Calendars) == 0 {
+		return "No calendars defined yet"
+	}
+	names := []string{}
+	for name := range p.Calendars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := []string{"#### List of calendars:"}
+	for _, name := range names {
+		calendar := p.Calendars[name]
+		lines = append(lines, fmt.Sprintf(" * %s", calendar.Name))
+		for _, r := range calendar.Ranges {
+			lines = append(lines, fmt.Sprintf("  * %s", r))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseICS(t *testing.T) {
+	data := "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"DTSTART;VALUE=DATE:20261225\r\n" +
+		"DTEND;VALUE=DATE:20261226\r\n" +
+		"SUMMARY:Christmas\r\n" +
+		"  Day\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"DTSTART:20261228T090000Z\r\n" +
+		"DTEND:20261231T180000Z\r\n" +
+		"SUMMARY:Freeze\\, no deploys\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	ranges, err := parseICS([]byte(data))
+	require.NoError(t, err)
+	assert.Equal(t, []*DateRange{
+		{Start: "2026-12-25", End: "2026-12-25", Summary: "Christmas Day"},
+		{Start: "2026-12-28", End: "2026-12-31", Summary: "Freeze, no deploys"},
+	}, ranges)
+
+	_, err = parseICS([]byte("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"))
+	assert.Error(t, err)
+}
+
+func TestNextQueueExecutionWithBlackout(t *testing.T) {
+	p := &Plugin{Calendars: map[string]*Calendar{
+		"holidays": {Name: "holidays", Ranges: []*DateRange{{Start: "2026-12-24", End: "2026-12-25"}}},
+	}}
+	queue := &Queue{
+		Spec:      mustParseSchedule(t, "0 10 * * 1-5"),
+		Timezone:  "UTC",
+		Calendars: []string{"holidays"},
+	}
+	from := time.Date(2026, 12, 23, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Date(2026, 12, 28, 10, 0, 0, 0, time.UTC), p.nextQueueExecution(queue, from))
+
+	queue.Spec = mustParseSchedule(t, "0 10 * * 4")
+	queue.BlackoutPolicy = blackoutPolicyPostpone
+	assert.Equal(t, time.Date(2026, 12, 26, 10, 0, 0, 0, time.UTC), p.nextQueueExecution(queue, from))
+}
+
+func TestNextQueueExecutionSkipsWholeBlackout(t *testing.T) {
+	p := &Plugin{Calendars: map[string]*Calendar{
+		"holidays": {Name: "holidays", Ranges: []*DateRange{
+			{Start: "2026-12-24", End: "2026-12-24"},
+			{Start: "2026-12-25", End: "2026-12-26"},
+		}},
+	}}
+	queue := &Queue{
+		Spec:      mustParseSchedule(t, "*/1 * * * *"),
+		Timezone:  "UTC",
+		Calendars: []string{"holidays"},
+	}
+	from := time.Date(2026, 12, 23, 23, 59, 30, 0, time.UTC)
+
+	assert.Equal(t, time.Date(2026, 12, 27, 0, 0, 0, 0, time.UTC), p.nextQueueExecution(queue, from))
+
+	queue.BlackoutPolicy = blackoutPolicyPostpone
+	from = time.Date(2026, 12, 24, 12, 0, 30, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, 12, 27, 12, 1, 0, 0, time.UTC), p.nextQueueExecution(queue, from))
+
+	p.Calendars["holidays"].Ranges = []*DateRange{{Start: "2026-01-01", End: "9999-12-31"}}
+	queue.BlackoutPolicy = blackoutPolicySkip
+	assert.True(t, p.nextQueueExecution(queue, from).IsZero())
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// checkChannelAvailable returns an error if the channel was archived or
+// deleted. Other errors getting the channel are not reported, as they may be
+// temporary.
+func (p *Plugin) checkChannelAvailable(channelID string) error {
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		if appErr.StatusCode == http.StatusNotFound {
+			return errors.New("the channel was deleted")
+		}
+		p.API.LogWarn("unable to check the channel", "channel_id", channelID, "err", appErr.Error())
+		return nil
+	}
+	if channel.DeleteAt != 0 {
+		return errors.Errorf("the channel ~%s was archived", channel.Name)
+	}
+	return nil
+}
+
+// pauseQueueForChannel pauses the queue because its channel is not available
+// anymore, and notifies the queue owners.
+func (p *Plugin) pauseQueueForChannel(queue *Queue, err error) {
+	p.setQueuePaused(queue, true)
+	message := fmt.Sprintf("The queue %s was paused because %s. Move it to another channel with `/%s set %s channel ~channel-name` and resume it with `/%s resume %s`, or delete it with `/%s delete %s`.",
+		queue.Name, err.Error(), queueCommand, queue.Name, queueCommand, queue.Name, queueCommand, queue.Name)
+	for _, userID := range queue.Owners() {
+		p.notifyUser(userID, message)
+	}
+}
+
+// cancelDeferredPostForChannel notifies the author that the deferred post was
+// cancelled because its channel is not available anymore.
+func (p *Plugin) cancelDeferredPostForChannel(post *model.Post, err error) {
+	p.notifyUser(post.UserId, fmt.Sprintf("Your deferred message was cancelled because %s:\n%s", err.Error(), previewMessage(post.Message)))
+}
+
+// sweepChannels pauses the queues and cancels the deferred posts whose
+// channels were archived or deleted.
+func (p *Plugin) sweepChannels() {
+	checked := map[string]error{}
+	check := func(channelID string) error {
+		if _, ok := checked[channelID]; !ok {
+			checked[channelID] = p.checkChannelAvailable(channelID)
+		}
+		return checked[channelID]
+	}
+
+	for _, queue := range p.Queues {
+		if queue.Paused || queue.Archived || queue.CompletedAt != 0 {
+			continue
+		}
+		if err := check(queue.ChannelId); err != nil {
+			p.pauseQueueForChannel(queue, err)
+		}
+	}
+
+	cancelled := []string{}
+	for _, deferredPost := range p.deferredPosts {
+		if err := check(deferredPost.Post.ChannelId); err != nil {
+			cancelled = append(cancelled, deferredPost.Post.Id)
+			p.cancelDeferredPostForChannel(deferredPost.Post, err)
+		}
+	}
+	for _, posts := range p.postsWaitingForOnline {
+		for _, post := range posts {
+			if err := check(post.ChannelId); err != nil {
+				cancelled = append(cancelled, post.Id)
+				p.cancelDeferredPostForChannel(post, err)
+			}
+		}
+	}
+	p.cancelDeferredPosts(cancelled)
+}
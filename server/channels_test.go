@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCheckChannelAvailable(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("GetChannel", "open").Return(&model.Channel{Id: "open", Name: "town-square"}, nil)
+	api.On("GetChannel", "archived").Return(&model.Channel{Id: "archived", Name: "old-news", DeleteAt: 1}, nil)
+	api.On("GetChannel", "deleted").Return(nil, model.NewAppError("GetChannel", "", nil, "not found", http.StatusNotFound))
+	api.On("GetChannel", "failing").Return(nil, model.NewAppError("GetChannel", "", nil, "timeout", http.StatusInternalServerError))
+	api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	assert.NoError(t, p.checkChannelAvailable("open"))
+	assert.EqualError(t, p.checkChannelAvailable("archived"), "the channel ~old-news was archived")
+	assert.EqualError(t, p.checkChannelAvailable("deleted"), "the channel was deleted")
+	assert.NoError(t, p.checkChannelAvailable("failing"))
+	api.AssertCalled(t, "LogWarn", "unable to check the channel", "channel_id", "failing", "err", mock.Anything)
+}
+
+func TestCancelDeferredPostForChannel(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("GetDirectChannel", "author", "bot").Return(&model.Channel{Id: "dm"}, nil)
+	api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+
+	p := &Plugin{botUserID: "bot"}
+	p.SetAPI(api)
+	p.cancelDeferredPostForChannel(&model.Post{UserId: "author", ChannelId: "archived", Message: "See you tomorrow\nat the demo"}, errors.New("the channel ~old-news was archived"))
+
+	api.AssertCalled(t, "CreatePost", &model.Post{
+		UserId:    "bot",
+		ChannelId: "dm",
+		Message:   "Your deferred message was cancelled because the channel ~old-news was archived:\nSee you tomorrow …",
+	})
+}
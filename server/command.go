@@ -7,8 +7,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/gorhill/cronexpr"
-
 	"github.com/mattermost/mattermost-server/v5/model"
 	"github.com/mattermost/mattermost-server/v5/plugin"
 )
@@ -39,41 +37,123 @@ func createQueueCommand() *model.Command {
 func getQueueAutocompleteData() *model.AutocompleteData {
 	queue := model.NewAutocompleteData("messages-queue", "[command]", "Defer a post message to some time later")
 
-	// * |/messages-queue remove-message <queue-name> <position>| - Remove a message from the queue in the specified position
-	// * |/messages-queue insert-message <queue-name> <position> <message>| - Add a new message to the queue in the speicified position
+	// * |/messages-queue remove-message <queue-name> <message-id>| - Remove a message from the queue
+	// * |/messages-queue insert-message <queue-name> <message-id> <message>| - Add a new message to the queue before the specified message
 
 	create := model.NewAutocompleteData("create", "[queue-name] [schedule]", "Create a new queue")
 	create.AddTextArgument("Name of the new queue", "[queue-name]", "")
-	create.AddTextArgument("Schedule in cron format", "[schedule]", "")
+	create.AddTextArgument("Schedule in cron format, or like @daily, @every 36h or every weekday at 10:00", "[schedule]", "")
 	queue.AddCommand(create)
 
 	deleteQueue := model.NewAutocompleteData("delete", "[queue-name]", "Delete a queue")
-	deleteQueue.AddTextArgument("Name of the queue", "[queue-name]", "")
+	deleteQueue.AddDynamicListArgument("Name of the queue", autocompleteQueuesURL, true)
 	queue.AddCommand(deleteQueue)
 
-	list := model.NewAutocompleteData("list", "", "List queues")
+	list := model.NewAutocompleteData("list", "[archived]", "List queues")
+	list.AddStaticListArgument("Show the archived queues", false, []model.AutocompleteListItem{
+		{Item: "archived", HelpText: "Show the archived queues instead of the active ones"},
+	})
 	queue.AddCommand(list)
 
 	listQueue := model.NewAutocompleteData("list-messages", "[queue-name]", "List pending messages in a queue")
-	listQueue.AddTextArgument("Name of the queue", "[queue-name]", "")
+	listQueue.AddDynamicListArgument("Name of the queue", autocompleteQueuesURL, true)
 	queue.AddCommand(listQueue)
 
+	set := model.NewAutocompleteData("set", "[queue-name] [setting] [value]", "Change a queue setting")
+	set.AddDynamicListArgument("Name of the queue", autocompleteQueuesURL, true)
+	set.AddStaticListArgument("Setting to change", true, []model.AutocompleteListItem{
+		{Item: "schedule", HelpText: "Schedule in cron format, or like @daily, @every 36h or every weekday at 10:00"},
+		{Item: "timezone", HelpText: "Timezone used to evaluate the schedule, like Europe/Madrid"},
+		{Item: "calendars", HelpText: "Comma separated list of blackout calendars, or none"},
+		{Item: "blackout-policy", HelpText: "What to do with the messages scheduled in blackout dates: skip or postpone"},
+		{Item: "starts-at", HelpText: "Date when the queue starts sending messages, or none"},
+		{Item: "ends-at", HelpText: "Date when the queue stops sending messages, or none"},
+		{Item: "max-sends", HelpText: "Maximum number of messages to send, or none"},
+		{Item: "on-completion", HelpText: "Comma separated list of actions when the queue completes: archive, delete and notify"},
+		{Item: "low-water", HelpText: "Alert the owners when the pending messages (like 5) or days of content (like 3d) go below this threshold, or none"},
+		{Item: "owners", HelpText: "Comma separated list of users that receive the queue notifications, or none"},
+		{Item: "channel", HelpText: "Channel where the queue sends the messages, like ~town-square, or here"},
+	})
+	set.AddTextArgument("New value of the setting", "[value]", "")
+	queue.AddCommand(set)
+
 	add := model.NewAutocompleteData("add-message", "[queue-name] [message]", "Add a message to the queue")
-	add.AddTextArgument("Name of the new queue", "[queue-name]", "")
+	add.AddDynamicListArgument("Name of the queue", autocompleteQueuesURL, true)
 	add.AddTextArgument("Message to add to the queue", "[message]", "")
 	queue.AddCommand(add)
 
-	remove := model.NewAutocompleteData("remove-message", "[queue-name] [position] [message]", "Remove a message from the queue")
-	remove.AddTextArgument("Name of the new queue", "[queue-name]", "")
-	remove.AddTextArgument("Position of the message", "[position]", "")
+	remove := model.NewAutocompleteData("remove-message", "[queue-name] [message-id]", "Remove a message from the queue")
+	remove.AddDynamicListArgument("Name of the queue", autocompleteQueuesURL, true)
+	remove.AddDynamicListArgument("Id or position of the message", autocompleteMessagesURL, true)
 	queue.AddCommand(remove)
 
-	insert := model.NewAutocompleteData("insert-message", "[queue-name] [position] [message]", "Insert a message in a position in the queue")
-	insert.AddTextArgument("Name of the new queue", "[queue-name]", "")
-	insert.AddTextArgument("Position of the message", "[position]", "")
+	pause := model.NewAutocompleteData("pause", "[queue-name]", "Stop sending the messages of the queue until it's resumed")
+	pause.AddDynamicListArgument("Name of the queue", autocompleteQueuesURL, true)
+	queue.AddCommand(pause)
+
+	resume := model.NewAutocompleteData("resume", "[queue-name]", "Send again the messages of a paused queue")
+	resume.AddDynamicListArgument("Name of the queue", autocompleteQueuesURL, true)
+	queue.AddCommand(resume)
+
+	addPost := model.NewAutocompleteData("add-post", "[queue-name] [post-link]", "Add a copy of a post, with its attachments and files, to the queue")
+	addPost.AddDynamicListArgument("Name of the queue", autocompleteQueuesURL, true)
+	addPost.AddTextArgument("Link to the post to copy", "[post-link]", "")
+	queue.AddCommand(addPost)
+
+	insert := model.NewAutocompleteData("insert-message", "[queue-name] [message-id] [message]", "Insert a message in a position in the queue")
+	insert.AddDynamicListArgument("Name of the queue", autocompleteQueuesURL, true)
+	insert.AddDynamicListArgument("Id or position of the message to insert before", autocompleteMessagesURL, true)
 	insert.AddTextArgument("Message to insert in the queue", "[message]", "")
 	queue.AddCommand(insert)
 
+	importMessages := model.NewAutocompleteData("import", "[queue-name] [post-link] [--confirm]", "Import messages from a CSV, JSON or Markdown file attached to a post")
+	importMessages.AddDynamicListArgument("Name of the queue", autocompleteQueuesURL, true)
+	importMessages.AddTextArgument("Link to the post with the file", "[post-link]", "")
+	importMessages.AddTextArgument("Add --confirm to import the messages, otherwise only a summary is shown", "[--confirm]", "")
+	queue.AddCommand(importMessages)
+
+	export := model.NewAutocompleteData("export", "[queue-name|--all] [--format=json|markdown]", "Export a queue, or all the queues, with their settings and messages")
+	export.AddTextArgument("Name of the queue, or --all to export all the queues", "[queue-name|--all]", "")
+	export.AddTextArgument("Format of the export, json by default", "[--format=json|markdown]", "")
+	queue.AddCommand(export)
+
+	history := model.NewAutocompleteData("history", "[queue-name]", "List the messages sent by a queue")
+	history.AddDynamicListArgument("Name of the queue", autocompleteQueuesURL, true)
+	queue.AddCommand(history)
+
+	resend := model.NewAutocompleteData("resend", "[queue-name] [history-id]", "Send again a message sent by a queue")
+	resend.AddDynamicListArgument("Name of the queue", autocompleteQueuesURL, true)
+	resend.AddTextArgument("Id of the sent message", "[history-id]", "")
+	queue.AddCommand(resend)
+
+	requeue := model.NewAutocompleteData("requeue", "[queue-name] [history-id]", "Add again to the queue a message sent by the queue")
+	requeue.AddDynamicListArgument("Name of the queue", autocompleteQueuesURL, true)
+	requeue.AddTextArgument("Id of the sent message", "[history-id]", "")
+	queue.AddCommand(requeue)
+
+	calendar := model.NewAutocompleteData("calendar", "[command]", "Manage the blackout calendars")
+	calendarCreate := model.NewAutocompleteData("create", "[calendar-name]", "Create a new blackout calendar")
+	calendarCreate.AddTextArgument("Name of the new calendar", "[calendar-name]", "")
+	calendar.AddCommand(calendarCreate)
+	calendarDelete := model.NewAutocompleteData("delete", "[calendar-name]", "Delete a blackout calendar")
+	calendarDelete.AddTextArgument("Name of the calendar", "[calendar-name]", "")
+	calendar.AddCommand(calendarDelete)
+	calendarList := model.NewAutocompleteData("list", "", "List the blackout calendars")
+	calendar.AddCommand(calendarList)
+	calendarAdd := model.NewAutocompleteData("add", "[calendar-name] [dates]", "Add dates to a blackout calendar")
+	calendarAdd.AddTextArgument("Name of the calendar", "[calendar-name]", "")
+	calendarAdd.AddTextArgument("Date (2006-01-02) or range of dates (2006-01-02..2006-01-31)", "[dates]", "")
+	calendar.AddCommand(calendarAdd)
+	calendarRemove := model.NewAutocompleteData("remove", "[calendar-name] [dates]", "Remove dates from a blackout calendar")
+	calendarRemove.AddTextArgument("Name of the calendar", "[calendar-name]", "")
+	calendarRemove.AddTextArgument("Date (2006-01-02) or range of dates (2006-01-02..2006-01-31)", "[dates]", "")
+	calendar.AddCommand(calendarRemove)
+	calendarImport := model.NewAutocompleteData("import", "[calendar-name] [post-link]", "Import the dates of an .ics file attached to a post")
+	calendarImport.AddTextArgument("Name of the calendar", "[calendar-name]", "")
+	calendarImport.AddTextArgument("Link to the post with the .ics file", "[post-link]", "")
+	calendar.AddCommand(calendarImport)
+	queue.AddCommand(calendar)
+
 	help := model.NewAutocompleteData("help", "", "Get slash command help")
 	queue.AddCommand(help)
 	return queue
@@ -82,17 +162,51 @@ func getQueueAutocompleteData() *model.AutocompleteData {
 func getDeferAutocompleteData() *model.AutocompleteData {
 	deferPost := model.NewAutocompleteData("defer-post", "[online|time] [message]", "Defer a post message to some time later")
 
-	online := model.NewAutocompleteData("online", "[message]", "Send the message when the user is online (only valid for DMs)")
-	online.AddTextArgument("Message to send", "[message]", "")
+	online := model.NewAutocompleteData("online", "[--max-wait=time] [--fallback=send|cancel|return] [message]", "Send the message when the user is online (only valid for DMs)")
+	online.AddTextArgument("Message to send, optionally after how long to wait and what to do then", "[--max-wait=time] [--fallback=send|cancel|return] [message]", "")
 	deferPost.AddCommand(online)
 
+	copyPost := model.NewAutocompleteData("copy", "[online|time] [post-link]", "Send later a copy of a post, with its attachments and files")
+	copyPost.AddTextArgument("online, or the time to wait like 2h", "[online|time]", "")
+	copyPost.AddTextArgument("Link to the post to copy", "[post-link]", "")
+	deferPost.AddCommand(copyPost)
+
+	quietHours := model.NewAutocompleteData("quiet-hours", "[start-end|off]", "Hold the direct messages sent to you during your quiet hours")
+	quietHours.AddTextArgument("Daily quiet hours in your timezone, like 22:00-08:00, or off", "[start-end|off]", "")
+	deferPost.AddCommand(quietHours)
+
+	hold := model.NewAutocompleteData("hold", "[on|off]", "Hold all the direct messages sent to you until you turn it off")
+	hold.AddStaticListArgument("Hold the direct messages", true, []model.AutocompleteListItem{
+		{Item: "on", HelpText: "Hold the direct messages sent to you"},
+		{Item: "off", HelpText: "Deliver the held direct messages"},
+	})
+	deferPost.AddCommand(hold)
+
+	admin := model.NewAutocompleteData("admin", "[command]", "Review and cancel the pending deferred posts of all the users")
+	admin.RoleID = model.SYSTEM_ADMIN_ROLE_ID
+	adminList := model.NewAutocompleteData("list", "[--user=@username] [--channel=~channel] [--content]", "List the pending deferred posts")
+	adminList.AddTextArgument("Filters, and --content to show the messages", "[--user=@username] [--channel=~channel] [--content]", "")
+	admin.AddCommand(adminList)
+	adminOrphaned := model.NewAutocompleteData("orphaned", "[--content]", "List the deferred posts and the queues of deactivated users")
+	admin.AddCommand(adminOrphaned)
+	adminCancel := model.NewAutocompleteData("cancel", "[post-id...|--user=@username|--orphaned]", "Cancel pending deferred posts")
+	adminCancel.AddTextArgument("Ids of the posts, or --user, --channel or --orphaned to cancel all of them", "[post-id...|--user=@username|--orphaned] [--channel=~channel]", "")
+	admin.AddCommand(adminCancel)
+	deferPost.AddCommand(admin)
+
 	help := model.NewAutocompleteData("help", "", "Get slash command help")
 	deferPost.AddCommand(help)
 	return deferPost
 }
 
 func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
-	split := strings.Fields(args.Command)
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	split := parseCommand(args.Command).Values()
+	if len(split) == 0 {
+		return &model.CommandResponse{}, nil
+	}
 	command := split[0]
 
 	if command == "/"+deferCommand {
@@ -106,15 +220,29 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 }
 
 func (p *Plugin) executeQueueCommand(c *plugin.Context, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
-	split := strings.Fields(args.Command)
+	command := parseCommand(args.Command)
+	split := command.Values()
 	if (len(split) == 2 && split[1] == "help") || len(split) == 1 {
 		return p.executeQueueHelpCommand(c, args)
 	}
 
-	if !p.API.HasPermissionTo(args.UserId, model.PERMISSION_MANAGE_SYSTEM) {
+	permissionChannelID := args.ChannelId
+	if len(split) > 2 {
+		if queue, ok := p.Queues[split[2]]; ok && split[1] != "calendar" && split[1] != "create" {
+			permissionChannelID = queue.ChannelId
+		}
+	}
+	if !p.canManageQueues(args.UserId, permissionChannelID) {
+		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+			ChannelId: args.ChannelId,
+			Message:   "Permission denied, you are not allowed to handle the messages queues of this channel",
+		})
+		return &model.CommandResponse{}, nil
+	}
+	if split[1] == "calendar" && len(split) > 2 && split[2] != "list" && !p.isSystemAdmin(args.UserId) {
 		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
 			ChannelId: args.ChannelId,
-			Message:   "Permission denied, only system admins can handle messages queues",
+			Message:   "Permission denied, only system admins can handle the blackout calendars",
 		})
 		return &model.CommandResponse{}, nil
 	}
@@ -127,56 +255,55 @@ func (p *Plugin) executeQueueCommand(c *plugin.Context, args *model.CommandArgs)
 			})
 			return &model.CommandResponse{}, nil
 		}
-		scheduleSpec, err := cronexpr.Parse(strings.Join(split[3:], " "))
-		if err != nil {
+		if _, ok := p.Queues[split[2]]; ok {
 			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
 				ChannelId: args.ChannelId,
-				Message:   "Unable to parse the schedule, please see the supported format in the help text",
+				Message:   fmt.Sprintf("Queue %s already exists", split[2]),
 			})
 			return &model.CommandResponse{}, nil
 		}
-		p.Queues[split[2]] = &Queue{
+		timezone := ""
+		if user, appErr := p.API.GetUser(args.UserId); appErr == nil {
+			timezone = user.GetPreferredTimezone()
+		}
+		if _, err := time.LoadLocation(timezone); err != nil || timezone == "" {
+			timezone = p.getConfiguration().DefaultTimezone
+		}
+		queue := &Queue{
 			Name:       split[2],
 			UserId:     args.UserId,
-			SpecSource: strings.Join(split[3:], " "),
-			Spec:       scheduleSpec,
+			CreatedAt:  model.GetMillis(),
+			SpecSource: command.RestValue(3),
+			Timezone:   timezone,
 			ChannelId:  args.ChannelId,
-			Messages:   []string{},
+			Messages:   []*QueueMessage{},
+		}
+		scheduleSpec, err := parseSchedule(queue.SpecSource, queue.Anchor(), queue.Location())
+		if err != nil {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("Unable to parse the schedule (%s), please see the supported format in the help text", err.Error()),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		queue.Spec = scheduleSpec
+		if p.nextQueueExecution(queue, time.Now()).IsZero() {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   "The schedule doesn't have any execution in the future",
+			})
+			return &model.CommandResponse{}, nil
 		}
+		p.Queues[split[2]] = queue
 		nErr := p.SaveQueues()
 		if nErr != nil {
 			p.API.LogError(nErr.Error())
 		}
-
-		var handleTimeout func()
-		handleTimeout = func() {
-			queue, ok := p.Queues[split[2]]
-			if !ok {
-				return
-			}
-			if len(queue.Messages) > 0 {
-				_, err := p.API.CreatePost(&model.Post{
-					UserId:    queue.UserId,
-					ChannelId: queue.ChannelId,
-					Message:   queue.Messages[0],
-				})
-				if err != nil {
-					p.API.LogError(err.Error())
-				}
-				queue.Messages = queue.Messages[1:]
-				nErr := p.SaveQueues()
-				if nErr != nil {
-					p.API.LogError(nErr.Error())
-				}
-			}
-			model.CreateTask(fmt.Sprintf("check queue %s", split[2]), handleTimeout, queue.Spec.Next(time.Now()).Sub(time.Now()))
-		}
-
-		model.CreateTask(fmt.Sprintf("check queue %s", split[2]), handleTimeout, scheduleSpec.Next(time.Now()).Sub(time.Now()))
+		p.scheduleQueue(queue)
 
 		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
 			ChannelId: args.ChannelId,
-			Message:   fmt.Sprintf("Scheduling a queue, next execution: %v", scheduleSpec.Next(time.Now())),
+			Message:   fmt.Sprintf("Scheduling the queue %s\n%s", queue.Name, p.describeQueueSchedule(queue)),
 		})
 		return &model.CommandResponse{}, nil
 	}
@@ -190,21 +317,27 @@ func (p *Plugin) executeQueueCommand(c *plugin.Context, args *model.CommandArgs)
 			return &model.CommandResponse{}, nil
 		}
 
+		showArchived := len(split) > 2 && split[2] == "archived"
 		queuesList := []string{}
-		for _, queue := range p.Queues {
-			nextMessage := "no messages in the queue"
-			if len(queue.Messages) > 0 {
-				nextMessage = queue.Messages[0]
+		for _, queue := range p.manageableQueues(args.UserId) {
+			if queue.Archived != showArchived {
+				continue
 			}
-			queuesList = append(queuesList, fmt.Sprintf(" * %s\n  * channel id: %s\n  * schedule spec: %s\n  * next execution: %s\n  * next message: %s",
-				queue.Name, queue.ChannelId, queue.SpecSource, queue.Spec.Next(time.Now()), nextMessage,
-			))
+			queuesList = append(queuesList, p.describeQueue(queue))
 		}
 
 		sort.Slice(queuesList, func(i, j int) bool {
 			return queuesList[i] < queuesList[j]
 		})
 
+		if len(queuesList) == 0 {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   "No queues found",
+			})
+			return &model.CommandResponse{}, nil
+		}
+
 		queuesList = append([]string{"#### List of queues:"}, queuesList...)
 		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
 			ChannelId: args.ChannelId,
@@ -229,7 +362,7 @@ func (p *Plugin) executeQueueCommand(c *plugin.Context, args *model.CommandArgs)
 			return &model.CommandResponse{}, nil
 		}
 
-		_, ok := p.Queues[split[2]]
+		queue, ok := p.Queues[split[2]]
 		if !ok {
 			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
 				ChannelId: args.ChannelId,
@@ -237,6 +370,7 @@ func (p *Plugin) executeQueueCommand(c *plugin.Context, args *model.CommandArgs)
 			})
 			return &model.CommandResponse{}, nil
 		}
+		cancelTask(queue.task)
 		delete(p.Queues, split[2])
 		nErr := p.SaveQueues()
 		if nErr != nil {
@@ -250,6 +384,264 @@ func (p *Plugin) executeQueueCommand(c *plugin.Context, args *model.CommandArgs)
 		return &model.CommandResponse{}, nil
 	}
 
+	if split[1] == "calendar" {
+		return p.executeQueueCalendarCommand(c, args)
+	}
+
+	if split[1] == "pause" || split[1] == "resume" {
+		if len(split) < 3 {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("Not enough arguments to %s the queue", split[1]),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		queue, ok := p.Queues[split[2]]
+		if !ok {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("Unknown queue %s.", split[2]),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		if split[1] == "resume" && !queue.Schedulable() {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("The queue %s has an %s, change it with `/%s set %s schedule <schedule>` before resuming it.", queue.Name, queue.Spec, queueCommand, queue.Name),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		p.setQueuePaused(queue, split[1] == "pause")
+		response := fmt.Sprintf("Queue %s paused", queue.Name)
+		if !queue.Paused {
+			response = fmt.Sprintf("Queue %s resumed", queue.Name)
+		}
+		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+			ChannelId: args.ChannelId,
+			Message:   response,
+		})
+		return &model.CommandResponse{}, nil
+	}
+
+	if split[1] == "set" {
+		if len(split) < 5 {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   "Not enough arguments to change the queue settings",
+			})
+			return &model.CommandResponse{}, nil
+		}
+		queue, ok := p.Queues[split[2]]
+		if !ok {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("Unknown queue %s.", split[2]),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		value := command.RestValue(4)
+		switch split[3] {
+		case "schedule":
+			if err := p.setQueueSchedule(queue, value); err != nil {
+				_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+					ChannelId: args.ChannelId,
+					Message:   fmt.Sprintf("Invalid schedule: %s. Please see the supported format in the help text.", err.Error()),
+				})
+				return &model.CommandResponse{}, nil
+			}
+		case "timezone":
+			loc, err := time.LoadLocation(value)
+			if err != nil {
+				_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+					ChannelId: args.ChannelId,
+					Message:   fmt.Sprintf("Unknown timezone %s, please use a timezone name like Europe/Madrid.", value),
+				})
+				return &model.CommandResponse{}, nil
+			}
+			scheduleSpec, err := parseSchedule(queue.SpecSource, queue.Anchor(), loc)
+			if err != nil {
+				_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+					ChannelId: args.ChannelId,
+					Message:   fmt.Sprintf("Unable to parse the schedule in the new timezone (%s)", err.Error()),
+				})
+				return &model.CommandResponse{}, nil
+			}
+			queue.Timezone = value
+			queue.Spec = scheduleSpec
+		case "calendars":
+			calendars := []string{}
+			if value != "none" {
+				for _, name := range strings.Split(value, ",") {
+					name = strings.TrimSpace(name)
+					if _, ok := p.Calendars[name]; !ok {
+						_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+							ChannelId: args.ChannelId,
+							Message:   fmt.Sprintf("Unknown calendar %s.", name),
+						})
+						return &model.CommandResponse{}, nil
+					}
+					calendars = append(calendars, name)
+				}
+			}
+			queue.Calendars = calendars
+		case "starts-at", "ends-at":
+			millis := int64(0)
+			if value != "none" {
+				date, _, err := parseScheduleDate(value, queue.Location())
+				if err != nil {
+					_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+						ChannelId: args.ChannelId,
+						Message:   fmt.Sprintf("Unable to parse the date (%s)", err.Error()),
+					})
+					return &model.CommandResponse{}, nil
+				}
+				millis = model.GetMillisForTime(date)
+			}
+			if split[3] == "starts-at" {
+				queue.StartsAt = millis
+			} else {
+				queue.EndsAt = millis
+			}
+		case "max-sends":
+			maxSends := 0
+			if value != "none" {
+				var err error
+				maxSends, err = strconv.Atoi(value)
+				if err != nil || maxSends < 1 {
+					_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+						ChannelId: args.ChannelId,
+						Message:   "Invalid maximum number of sends, it must be a positive number or none.",
+					})
+					return &model.CommandResponse{}, nil
+				}
+			}
+			queue.MaxSends = maxSends
+		case "on-completion":
+			actions := []string{}
+			if value != "none" {
+				for _, action := range strings.Split(value, ",") {
+					action = strings.TrimSpace(action)
+					if action != completionActionArchive && action != completionActionDelete && action != completionActionNotify {
+						_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+							ChannelId: args.ChannelId,
+							Message:   fmt.Sprintf("Invalid action %s, the valid actions are %s, %s and %s.", action, completionActionArchive, completionActionDelete, completionActionNotify),
+						})
+						return &model.CommandResponse{}, nil
+					}
+					actions = append(actions, action)
+				}
+			}
+			queue.OnCompletion = actions
+		case "low-water":
+			threshold, unit := 0, ""
+			if value != "none" {
+				var err error
+				threshold, unit, err = parseLowWater(value)
+				if err != nil {
+					_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+						ChannelId: args.ChannelId,
+						Message:   err.Error(),
+					})
+					return &model.CommandResponse{}, nil
+				}
+			}
+			queue.LowWater = threshold
+			queue.LowWaterUnit = unit
+			queue.LowWaterAlert = false
+			queue.EmptyAlert = false
+			p.checkQueueLowWater(queue)
+		case "owners":
+			owners := []string{}
+			if value != "none" {
+				for _, username := range strings.Split(value, ",") {
+					username = strings.TrimPrefix(strings.TrimSpace(username), "@")
+					user, appErr := p.API.GetUserByUsername(username)
+					if appErr != nil {
+						_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+							ChannelId: args.ChannelId,
+							Message:   fmt.Sprintf("Unknown user %s.", username),
+						})
+						return &model.CommandResponse{}, nil
+					}
+					owners = append(owners, user.Id)
+				}
+			}
+			queue.OwnerIds = owners
+		case "catch-up":
+			switch value {
+			case "default", "none":
+				value = ""
+			case catchUpPolicySkip, catchUpPolicySend:
+			default:
+				_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+					ChannelId: args.ChannelId,
+					Message:   fmt.Sprintf("Invalid catch up policy %s, the valid policies are %s, %s and default.", value, catchUpPolicySkip, catchUpPolicySend),
+				})
+				return &model.CommandResponse{}, nil
+			}
+			queue.CatchUpPolicy = value
+		case "channel":
+			channelID := args.ChannelId
+			if value != "here" {
+				channel, appErr := p.API.GetChannelByName(args.TeamId, strings.TrimPrefix(value, "~"), false)
+				if appErr != nil {
+					_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+						ChannelId: args.ChannelId,
+						Message:   fmt.Sprintf("Unknown channel %s.", value),
+					})
+					return &model.CommandResponse{}, nil
+				}
+				channelID = channel.Id
+			}
+			if err := p.checkChannelAvailable(channelID); err != nil {
+				_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+					ChannelId: args.ChannelId,
+					Message:   fmt.Sprintf("Unable to move the queue: %s.", err.Error()),
+				})
+				return &model.CommandResponse{}, nil
+			}
+			if !p.canManageQueues(args.UserId, channelID) {
+				_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+					ChannelId: args.ChannelId,
+					Message:   "Permission denied, you are not allowed to handle the messages queues of that channel",
+				})
+				return &model.CommandResponse{}, nil
+			}
+			queue.ChannelId = channelID
+		case "blackout-policy":
+			if value != blackoutPolicySkip && value != blackoutPolicyPostpone {
+				_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+					ChannelId: args.ChannelId,
+					Message:   fmt.Sprintf("Invalid blackout policy %s, the valid policies are %s and %s.", value, blackoutPolicySkip, blackoutPolicyPostpone),
+				})
+				return &model.CommandResponse{}, nil
+			}
+			queue.BlackoutPolicy = value
+		default:
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("Unknown setting %s, please see the help text.", split[3]),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		// The settings that end the queue may make a completed queue active
+		// again.
+		if split[3] == "schedule" || split[3] == "ends-at" || split[3] == "max-sends" {
+			queue.CompletedAt = 0
+			queue.Archived = false
+		}
+		p.scheduleQueue(queue)
+		nErr := p.SaveQueues()
+		if nErr != nil {
+			p.API.LogError(nErr.Error())
+		}
+		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+			ChannelId: args.ChannelId,
+			Message:   fmt.Sprintf("Queue %s updated\n%s", queue.Name, p.describeQueueSchedule(queue)),
+		})
+		return &model.CommandResponse{}, nil
+	}
+
 	if split[1] == "add-message" {
 		if len(split) < 4 {
 			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
@@ -266,14 +658,80 @@ func (p *Plugin) executeQueueCommand(c *plugin.Context, args *model.CommandArgs)
 			})
 			return &model.CommandResponse{}, nil
 		}
-		queue.Messages = append(queue.Messages, strings.Join(split[3:], " "))
+		if err := p.checkQueueLength(queue, 1); err != nil {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("Unable to add the message: %s", err.Error()),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		if err := validateMessageTemplate(command.Rest(3), true); err != nil {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("Unable to add the message: %s", err.Error()),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		message := queue.NewMessage(command.Rest(3), args.UserId)
+		queue.Messages = append(queue.Messages, message)
+		p.checkQueueLowWater(queue)
+		nErr := p.SaveQueues()
+		if nErr != nil {
+			p.API.LogError(nErr.Error())
+		}
+		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+			ChannelId: args.ChannelId,
+			Message:   fmt.Sprintf("Message %s added to the queue", message.ID),
+		})
+		return &model.CommandResponse{}, nil
+	}
+
+	if split[1] == "add-post" {
+		if len(split) < 4 {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   "Not enough arguments to add a post",
+			})
+			return &model.CommandResponse{}, nil
+		}
+		queue, ok := p.Queues[split[2]]
+		if !ok {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("Unknown queue %s.", split[2]),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		if err := p.checkQueueLength(queue, 1); err != nil {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("Unable to add the post: %s", err.Error()),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		payload, err := p.copyPostPayload(args.UserId, split[3])
+		if err == nil {
+			err = validateMessageTemplate(payload.Message, true)
+		}
+		if err != nil {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("Unable to add the post: %s", err.Error()),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		message := queue.NewMessage(payload.Message, args.UserId)
+		message.Props = payload.GetProps()
+		message.FileIds = payload.FileIds
+		queue.Messages = append(queue.Messages, message)
+		p.checkQueueLowWater(queue)
 		nErr := p.SaveQueues()
 		if nErr != nil {
 			p.API.LogError(nErr.Error())
 		}
 		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
 			ChannelId: args.ChannelId,
-			Message:   "Message added to the queue",
+			Message:   fmt.Sprintf("Message %s added to the queue", message.ID),
 		})
 		return &model.CommandResponse{}, nil
 	}
@@ -294,15 +752,16 @@ func (p *Plugin) executeQueueCommand(c *plugin.Context, args *model.CommandArgs)
 			})
 			return &model.CommandResponse{}, nil
 		}
-		idx, err := strconv.ParseUint(split[3], 10, 32)
-		if err != nil {
+		idx, ok := queue.FindMessage(split[3])
+		if !ok {
 			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
 				ChannelId: args.ChannelId,
-				Message:   "Invalid position, please see the list-messages command result.",
+				Message:   "Invalid message id or position, please see the list-messages command result.",
 			})
 			return &model.CommandResponse{}, nil
 		}
 		queue.Messages = append(queue.Messages[:idx], queue.Messages[idx+1:]...)
+		p.checkQueueLowWater(queue)
 		nErr := p.SaveQueues()
 		if nErr != nil {
 			p.API.LogError(nErr.Error())
@@ -330,38 +789,54 @@ func (p *Plugin) executeQueueCommand(c *plugin.Context, args *model.CommandArgs)
 			})
 			return &model.CommandResponse{}, nil
 		}
-		idx, err := strconv.ParseUint(split[3], 10, 32)
-		if err != nil {
+		idx, ok := queue.FindMessage(split[3])
+		if !ok {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   "Invalid message id or position, please see the list-messages command result.",
+			})
+			return &model.CommandResponse{}, nil
+		}
+		if err := p.checkQueueLength(queue, 1); err != nil {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("Unable to add the message: %s", err.Error()),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		if err := validateMessageTemplate(command.Rest(4), true); err != nil {
 			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
 				ChannelId: args.ChannelId,
-				Message:   "Invalid position, please see the list-messages command result.",
+				Message:   fmt.Sprintf("Unable to add the message: %s", err.Error()),
 			})
 			return &model.CommandResponse{}, nil
 		}
-		newMessages := []string{}
-		for i, message := range queue.Messages {
-			if uint64(i) == idx {
-				newMessages = append(newMessages, strings.Join(split[4:], " "))
+		message := queue.NewMessage(command.Rest(4), args.UserId)
+		newMessages := []*QueueMessage{}
+		for i, queueMessage := range queue.Messages {
+			if i == idx {
+				newMessages = append(newMessages, message)
 			}
-			newMessages = append(newMessages, message)
+			newMessages = append(newMessages, queueMessage)
 		}
 		queue.Messages = newMessages
+		p.checkQueueLowWater(queue)
 		nErr := p.SaveQueues()
 		if nErr != nil {
 			p.API.LogError(nErr.Error())
 		}
 		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
 			ChannelId: args.ChannelId,
-			Message:   "Message inserted in the queue",
+			Message:   fmt.Sprintf("Message %s inserted in the queue", message.ID),
 		})
 		return &model.CommandResponse{}, nil
 	}
 
-	if split[1] == "list-messages" {
-		if len(split) < 3 {
+	if split[1] == "import" {
+		if len(split) < 4 {
 			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
 				ChannelId: args.ChannelId,
-				Message:   "Not enough arguments to list messages",
+				Message:   "Not enough arguments to import messages",
 			})
 			return &model.CommandResponse{}, nil
 		}
@@ -373,86 +848,326 @@ func (p *Plugin) executeQueueCommand(c *plugin.Context, args *model.CommandArgs)
 			})
 			return &model.CommandResponse{}, nil
 		}
-
-		listOfMessages := []string{fmt.Sprintf("#### List of messages for the queue %s:", queue.Name)}
-		for id, message := range queue.Messages {
-			listOfMessages = append(listOfMessages, fmt.Sprintf(" * **%d**: %s", id, message))
-		}
-		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
-			ChannelId: args.ChannelId,
-			Message:   strings.Join(listOfMessages, "\n"),
-		})
-		return &model.CommandResponse{}, nil
-	}
-	_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
-		ChannelId: args.ChannelId,
-		Message:   "Unknown command, please use /" + queueCommand + " help for more information.",
-	})
-	return &model.CommandResponse{}, nil
-}
-
-func (p *Plugin) executeDeferCommand(c *plugin.Context, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
-	split := strings.Fields(args.Command)
-	timeSpec := ""
-	if len(split) < 3 {
-		if len(split) == 2 && split[1] == "help" {
-			return p.executeDeferHelpCommand(c, args)
+		flags := command.Flags(4)
+		_, confirm := flags["confirm"]
+		dryRun := !confirm
+		format := flags["format"]
+		extensions := []string{"csv", "json", "md", "markdown", "txt"}
+		if format != "" {
+			extensions = nil
 		}
-
-		return &model.CommandResponse{
-			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
-			ChannelId:    args.ChannelId,
-			Text:         "Not enough parameters",
-		}, nil
-	}
-
-	timeSpec = split[1]
-	messageStart := strings.Index(args.Command, timeSpec) + len(timeSpec)
-	message := args.Command[messageStart:]
-
-	if timeSpec == "online" {
-		channel, appErr := p.API.GetChannel(args.ChannelId)
-		if appErr != nil {
+		attachments, err := p.getPostAttachments(args.UserId, split[3], extensions...)
+		if err != nil {
 			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
 				ChannelId: args.ChannelId,
-				Message:   "Unable to defer the message until the user is online",
+				Message:   fmt.Sprintf("Unable to import the messages: %s", err.Error()),
 			})
 			return &model.CommandResponse{}, nil
 		}
-		if channel.Type != model.CHANNEL_DIRECT {
+		attachment := attachments[0]
+		if format == "" {
+			format = importFormatFromFilename(attachment.Info.Name)
+		}
+		messages, err := parseImport(attachment.Data, format, queue.Name)
+		if err == nil {
+			err = p.checkImportedPayloads(args.UserId, messages)
+		}
+		if err != nil {
 			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
 				ChannelId: args.ChannelId,
-				Message:   "Unable to defer the message until the user is online in not DMs channels",
+				Message:   fmt.Sprintf("Unable to import the messages from %s: %s", attachment.Info.Name, err.Error()),
 			})
 			return &model.CommandResponse{}, nil
 		}
 
-		members, appErr := p.API.GetChannelMembers(args.ChannelId, 0, 10)
-		if appErr != nil {
+		if err := p.checkQueueLength(queue, len(messages)); err != nil {
 			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
 				ChannelId: args.ChannelId,
-				Message:   "Unable to defer the message until the user is online",
+				Message:   fmt.Sprintf("Unable to import the messages: %s", err.Error()),
 			})
-			p.API.LogError("unable to get channel members of the channel", "err", appErr.Error())
 			return &model.CommandResponse{}, nil
 		}
-
-		otherUserId := ""
-		for _, member := range *members {
-			if member.UserId != args.UserId {
-				otherUserId = member.UserId
+		summary := importSummary(queue, messages, dryRun)
+		if dryRun {
+			summary += fmt.Sprintf("\n\nNothing has been imported yet, run `/%s import %s %s --confirm` to add the messages to the queue.", queueCommand, queue.Name, split[3])
+		} else {
+			p.importQueueMessages(queue, messages, args.UserId)
+			nErr := p.SaveQueues()
+			if nErr != nil {
+				p.API.LogError(nErr.Error())
 			}
 		}
-
-		p.postsWaitingForOnline[otherUserId] = append(p.postsWaitingForOnline[otherUserId], &model.Post{
-			UserId:    args.UserId,
+		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
 			ChannelId: args.ChannelId,
-			RootId:    args.RootId,
-			ParentId:  args.ParentId,
-			Message:   message,
+			Message:   summary,
 		})
-		p.SaveWaitingForOnlinePosts()
-		return &model.CommandResponse{
+		return &model.CommandResponse{}, nil
+	}
+
+	if split[1] == "export" {
+		if len(split) < 3 {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   "Not enough arguments to export the queues",
+			})
+			return &model.CommandResponse{}, nil
+		}
+		format := command.Flags(3)["format"]
+		queues := []*Queue{}
+		if split[2] == "--all" {
+			queues = p.manageableQueues(args.UserId)
+		} else {
+			queue, ok := p.Queues[split[2]]
+			if !ok {
+				_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+					ChannelId: args.ChannelId,
+					Message:   fmt.Sprintf("Unknown queue %s.", split[2]),
+				})
+				return &model.CommandResponse{}, nil
+			}
+			queues = append(queues, queue)
+		}
+		data, filename, err := exportQueues(queues, format)
+		if err != nil {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("Unable to export the queues: %s", err.Error()),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		fileInfo, appErr := p.API.UploadFile(data, args.ChannelId, filename)
+		if appErr != nil {
+			p.API.LogError("failed to upload the export", "err", appErr.Error())
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   "Unable to export the queues, the file can't be uploaded",
+			})
+			return &model.CommandResponse{}, nil
+		}
+		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+			ChannelId: args.ChannelId,
+			Message:   fmt.Sprintf("%d queues exported to %s", len(queues), filename),
+			FileIds:   []string{fileInfo.Id},
+		})
+		return &model.CommandResponse{}, nil
+	}
+
+	if split[1] == "history" {
+		if len(split) < 3 {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   "Not enough arguments to show the history",
+			})
+			return &model.CommandResponse{}, nil
+		}
+		queue, ok := p.Queues[split[2]]
+		if !ok {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("Unknown queue %s.", split[2]),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+			ChannelId: args.ChannelId,
+			Message:   p.describeQueueHistory(queue),
+		})
+		return &model.CommandResponse{}, nil
+	}
+
+	if split[1] == "resend" || split[1] == "requeue" {
+		if len(split) < 4 {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("Not enough arguments to %s a message", split[1]),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		queue, ok := p.Queues[split[2]]
+		if !ok {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("Unknown queue %s.", split[2]),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		item, ok := queue.FindHistoryItem(split[3])
+		if !ok {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   "Invalid history id, please see the history command result.",
+			})
+			return &model.CommandResponse{}, nil
+		}
+
+		response := ""
+		if split[1] == "resend" {
+			err := p.checkChannelAvailable(queue.ChannelId)
+			authorID := ""
+			if err == nil {
+				authorID, err = p.deliveryAuthor(queue.UserId, queue.ChannelId)
+			}
+			if err != nil {
+				_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+					ChannelId: args.ChannelId,
+					Message:   fmt.Sprintf("Unable to resend the message: %s", err.Error()),
+				})
+				return &model.CommandResponse{}, nil
+			}
+			if _, appErr := p.sendQueueMessage(queue, item.Message, authorID); appErr != nil {
+				p.API.LogError("failed to resend the queue message", "err", appErr.Error())
+				_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+					ChannelId: args.ChannelId,
+					Message:   "Unable to resend the message",
+				})
+				return &model.CommandResponse{}, nil
+			}
+			response = "Message sent again"
+		} else {
+			if err := p.checkQueueLength(queue, 1); err != nil {
+				_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+					ChannelId: args.ChannelId,
+					Message:   fmt.Sprintf("Unable to add the message: %s", err.Error()),
+				})
+				return &model.CommandResponse{}, nil
+			}
+			message := queue.NewMessage(item.Message.Message, args.UserId)
+			message.Metadata = item.Message.Metadata
+			message.Props = item.Message.Props
+			message.FileIds = item.Message.FileIds
+			queue.Messages = append(queue.Messages, message)
+			p.checkQueueLowWater(queue)
+			response = fmt.Sprintf("Message %s added again to the queue", message.ID)
+		}
+		nErr := p.SaveQueues()
+		if nErr != nil {
+			p.API.LogError(nErr.Error())
+		}
+		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+			ChannelId: args.ChannelId,
+			Message:   response,
+		})
+		return &model.CommandResponse{}, nil
+	}
+
+	if split[1] == "list-messages" {
+		if len(split) < 3 {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   "Not enough arguments to list messages",
+			})
+			return &model.CommandResponse{}, nil
+		}
+		queue, ok := p.Queues[split[2]]
+		if !ok {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("Unknown queue %s.", split[2]),
+			})
+			return &model.CommandResponse{}, nil
+		}
+
+		listOfMessages := []string{fmt.Sprintf("#### List of messages for the queue %s:", queue.Name)}
+		for position, message := range queue.Messages {
+			listOfMessages = append(listOfMessages, strings.TrimSpace(fmt.Sprintf(" * **%s** (%d): %s %s", message.ID, position, message.Message, message.describePayload())))
+		}
+		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+			ChannelId: args.ChannelId,
+			Message:   strings.Join(listOfMessages, "\n"),
+		})
+		return &model.CommandResponse{}, nil
+	}
+	_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+		ChannelId: args.ChannelId,
+		Message:   "Unknown command, please use /" + queueCommand + " help for more information.",
+	})
+	return &model.CommandResponse{}, nil
+}
+
+func (p *Plugin) executeDeferCommand(c *plugin.Context, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	command := parseCommand(args.Command)
+	split := command.Values()
+	timeSpec := ""
+	if len(split) >= 2 && split[1] == "admin" {
+		return p.executeDeferAdminCommand(c, args)
+	}
+	if len(split) >= 2 && (split[1] == "quiet-hours" || split[1] == "hold") {
+		return p.executeQuietHoursCommand(c, args)
+	}
+	if len(split) < 3 {
+		if len(split) == 2 && split[1] == "help" {
+			return p.executeDeferHelpCommand(c, args)
+		}
+
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			ChannelId:    args.ChannelId,
+			Text:         "Not enough parameters",
+		}, nil
+	}
+
+	timeSpec = split[1]
+	position := 2
+	if timeSpec == "copy" {
+		timeSpec = split[2]
+		position = 3
+	}
+	options := &onlineDeferral{}
+	for timeSpec == "online" && position < len(split) && (isCommandFlag(split[position]) || split[position] == "--") {
+		if split[position] == "--" {
+			position++
+			break
+		}
+		option := strings.SplitN(strings.TrimPrefix(split[position], "--"), "=", 2)
+		if len(option) < 2 {
+			option = append(option, "")
+		}
+		if err := options.Set(option[0], option[1]); err != nil {
+			return &model.CommandResponse{
+				ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+				ChannelId:    args.ChannelId,
+				Text:         err.Error(),
+			}, nil
+		}
+		position++
+	}
+	if position >= len(split) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			ChannelId:    args.ChannelId,
+			Text:         "Not enough parameters",
+		}, nil
+	}
+
+	payload := &model.Post{Message: command.Rest(position)}
+	if split[1] == "copy" {
+		var err error
+		payload, err = p.copyPostPayload(args.UserId, split[position])
+		if err != nil {
+			return &model.CommandResponse{
+				ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+				ChannelId:    args.ChannelId,
+				Text:         fmt.Sprintf("Unable to defer the post: %s", err.Error()),
+			}, nil
+		}
+	}
+	if err := validateMessageTemplate(payload.Message, false); err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			ChannelId:    args.ChannelId,
+			Text:         fmt.Sprintf("Unable to defer the message: %s", err.Error()),
+		}, nil
+	}
+
+	if timeSpec == "online" {
+		if err := p.deferPostUntilOnline(newDeferredPost(payload, args), options); err != nil {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   err.Error(),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		return &model.CommandResponse{
 			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
 			ChannelId:    args.ChannelId,
 			Text:         "Message deferred",
@@ -471,21 +1186,13 @@ func (p *Plugin) executeDeferCommand(c *plugin.Context, args *model.CommandArgs)
 			}
 	}
 
-	deferredPost := model.Post{
-		UserId:    args.UserId,
-		ChannelId: args.ChannelId,
-		RootId:    args.RootId,
-		ParentId:  args.ParentId,
-		Message:   message,
-	}
-	p.deferredPosts = append(p.deferredPosts, &DeferredPost{Time: time.Now().Add(duration), Post: &deferredPost})
-	p.SaveDeferredPosts()
-	model.CreateTask("defer message", func() {
-		_, err := p.API.CreatePost(&deferredPost)
-		if err != nil {
-			p.API.LogError(err.Error())
-		}
-	}, duration)
+	if err := p.deferPost(newDeferredPost(payload, args), duration); err != nil {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			ChannelId:    args.ChannelId,
+			Text:         err.Error(),
+		}, nil
+	}
 
 	return &model.CommandResponse{
 		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
@@ -498,7 +1205,13 @@ func (p *Plugin) executeDeferHelpCommand(c *plugin.Context, args *model.CommandA
 	helpTitle := `###### Defer Post - Slash Command help
 `
 	commandHelp := `* |/defer-post [time] [message]| - Send the message after the time has passed
-* |/defer-post online [message]| - Send the message when the user is online (only valid for DMs)
+* |/defer-post online [--max-wait=time] [--fallback=send|cancel|return] [message]| - Send the message when the user is online (only valid for DMs). After the maximum wait the message is sent anyway, cancelled, or returned to you
+* |/defer-post copy [time|online] [post-link]| - Send later a copy of a post, with its message attachments and files
+* |/defer-post quiet-hours [start-end|off]| - Show or set your daily quiet hours, like |22:00-08:00|. The direct messages sent to you during them are delivered when they end
+* |/defer-post hold [on|off]| - Hold all the direct messages sent to you until you turn it off
+* |/defer-post admin list [--user=@username] [--channel=~channel] [--content]| - List the pending deferred posts of all the users (system admins only)
+* |/defer-post admin orphaned [--content]| - List the deferred posts and the queues of deactivated users, and the posts waiting for them to be online (system admins only)
+* |/defer-post admin cancel [post-id...|--user=@username|--orphaned] [--channel=~channel]| - Cancel pending deferred posts by id, or all the ones of a user or channel, or the orphaned ones (system admins only)
 * |/defer-post help| - Show this help text
 
 ###### Time format:
@@ -513,20 +1226,154 @@ func (p *Plugin) executeDeferHelpCommand(c *plugin.Context, args *model.CommandA
 	return &model.CommandResponse{}, nil
 }
 
+func (p *Plugin) executeDeferAdminCommand(c *plugin.Context, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	command := parseCommand(args.Command)
+	split := command.Values()
+	if !p.isSystemAdmin(args.UserId) {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			ChannelId:    args.ChannelId,
+			Text:         "Only the system admins can manage the deferred posts of all the users",
+		}, nil
+	}
+	if len(split) < 3 || (split[2] != "list" && split[2] != "cancel" && split[2] != "orphaned") {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			ChannelId:    args.ChannelId,
+			Text:         "Use /defer-post admin list, /defer-post admin orphaned or /defer-post admin cancel",
+		}, nil
+	}
+
+	flags := command.Flags(3)
+	filter := &deferredPostsFilter{}
+	_, filter.ShowContent = flags["content"]
+	_, filter.Orphaned = flags["orphaned"]
+	if username, ok := flags["user"]; ok {
+		user, appErr := p.API.GetUserByUsername(strings.TrimPrefix(username, "@"))
+		if appErr != nil {
+			return &model.CommandResponse{
+				ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+				ChannelId:    args.ChannelId,
+				Text:         fmt.Sprintf("Unknown user %s.", username),
+			}, nil
+		}
+		filter.UserID = user.Id
+	}
+	if channelName, ok := flags["channel"]; ok {
+		channel, appErr := p.API.GetChannelByName(args.TeamId, strings.TrimPrefix(channelName, "~"), false)
+		if appErr != nil {
+			return &model.CommandResponse{
+				ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+				ChannelId:    args.ChannelId,
+				Text:         fmt.Sprintf("Unknown channel %s.", channelName),
+			}, nil
+		}
+		filter.ChannelID = channel.Id
+	}
+
+	if split[2] == "list" {
+		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+			ChannelId: args.ChannelId,
+			Message:   p.describeDeferredPostsReport(p.deferredPostsReport(filter)),
+		})
+		return &model.CommandResponse{}, nil
+	}
+	if split[2] == "orphaned" {
+		filter.Orphaned = true
+		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+			ChannelId: args.ChannelId,
+			Message:   p.describeDeferredPostsReport(p.deferredPostsReport(filter)) + "\n\n" + p.describeOrphanedQueues(p.orphanedQueues()),
+		})
+		return &model.CommandResponse{}, nil
+	}
+
+	ids := []string{}
+	for _, id := range split[3:] {
+		if !strings.HasPrefix(id, "--") {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		if filter.UserID == "" && filter.ChannelID == "" && !filter.Orphaned {
+			return &model.CommandResponse{
+				ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+				ChannelId:    args.ChannelId,
+				Text:         "Specify the ids of the posts to cancel, or a --user, --channel or --orphaned",
+			}, nil
+		}
+		for _, summary := range p.deferredPostsReport(filter).Posts {
+			ids = append(ids, summary.ID)
+		}
+	}
+	cancelled := p.cancelDeferredPosts(ids)
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		ChannelId:    args.ChannelId,
+		Text:         fmt.Sprintf("%d deferred posts cancelled", cancelled),
+	}, nil
+}
+
 func (p *Plugin) executeQueueHelpCommand(c *plugin.Context, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
 	helpTitle := `###### Messages Queue - Slash Command help
 `
 	commandHelp := `* |/messages-queue create <name> <schedule>| - Create a queue for the current channel (see the Schedule format help at the bottom)
-* |/messages-queue list| - List the queues for this channel
+* |/messages-queue list [archived]| - List the queues you can manage, or the archived ones
 * |/messages-queue delete <queue-name>| - Delete a queue.
+* |/messages-queue set <queue-name> <setting> <value>| - Change a queue setting (see the Queue settings help at the bottom)
+* |/messages-queue pause <queue-name>| - Stop sending the messages of the queue until it's resumed
+* |/messages-queue resume <queue-name>| - Send again the messages of a paused queue
 * |/messages-queue add-message <queue-name> <message>| - Add a new message to the queue
+* |/messages-queue add-post <queue-name> <post-link>| - Add a copy of a post, with its message attachments and files, to the queue
 * |/messages-queue list-messages <queue-name>| - Add a new message the the queue
-* |/messages-queue remove-message <queue-name> <position>| - Remove a message from the queue in the specified position
-* |/messages-queue insert-message <queue-name> <position> <message>| - Add a new message to the queue in the specified position
+* |/messages-queue remove-message <queue-name> <message-id>| - Remove a message from the queue (the position in the queue is also accepted)
+* |/messages-queue insert-message <queue-name> <message-id> <message>| - Add a new message to the queue before the specified message (the position in the queue is also accepted)
+* |/messages-queue import <queue-name> <post-link> [--confirm] [--format=<format>]| - Import messages from a file attached to a post (see the Import format help at the bottom). Without |--confirm| only a summary of the messages is shown
+* |/messages-queue export <queue-name|--all> [--format=<format>]| - Export a queue, or all of them, with their settings and messages to a |json| (default) or |markdown| file that can be imported again
+* |/messages-queue history <queue-name>| - List the last messages sent by the queue
+* |/messages-queue resend <queue-name> <history-id>| - Send again now a message sent by the queue
+* |/messages-queue requeue <queue-name> <history-id>| - Add again to the end of the queue a message sent by the queue
+* |/messages-queue calendar create <calendar-name>| - Create a blackout calendar
+* |/messages-queue calendar delete <calendar-name>| - Delete a blackout calendar
+* |/messages-queue calendar list| - List the blackout calendars and their dates
+* |/messages-queue calendar add <calendar-name> <dates>| - Add a date (2006-01-02) or range of dates (2006-01-02..2006-01-31) to a blackout calendar
+* |/messages-queue calendar remove <calendar-name> <dates>| - Remove a date or range of dates from a blackout calendar
+* |/messages-queue calendar import <calendar-name> <post-link>| - Add the dates of the events of an .ics file attached to a post to a blackout calendar
 * |/messages-queue help| - Show this help text
 
 ###### Schedule format:
-* The schedule format used is the cron expresion format, you can see more information [here](https://en.wikipedia.org/wiki/Cron)
+* The schedule can be defined in any of these formats:
+  * Cron expressions, like |0 10 * * 1-5|, you can see more information [here](https://en.wikipedia.org/wiki/Cron)
+  * Cron descriptors: |@hourly|, |@daily|, |@weekly|, |@monthly| and |@yearly|
+  * Fixed intervals, like |@every 36h| or |every 90 minutes|
+  * English sentences, like |every weekday at 10:00|, |every monday and thursday at 9am|, |every other monday at 9|, |every weekend at noon| or |every month on the 15th at 12:00|
+* Several expressions can be combined separating them with |;|, like |0 9 * * 1-5; 0 12 * * 6|
+* The schedule can be limited adding |from <date>| and |until <date>| parts, like |@every 36h; from 2026-11-02 09:00; until 2026-12-31|. The intervals are counted from the |from| date
+* The schedule is evaluated in the queue timezone, which by default is the timezone of the user that creates the queue
+
+###### Queue settings:
+* |schedule|: The schedule of the queue (see the Schedule format help)
+* |timezone|: Timezone used to evaluate the schedule, like |Europe/Madrid|
+* |calendars|: Comma separated list of blackout calendars, or |none|. The queue doesn't send messages in the calendar dates
+* |blackout-policy|: What to do with the messages scheduled in blackout dates, |skip| them (default) or |postpone| them to the same time of the first date after the blackout
+* |starts-at|: Date (like |2006-01-02| or |2006-01-02 15:04|) when the queue starts sending messages, or |none|
+* |ends-at|: Date when the queue stops sending messages, or |none|
+* |max-sends|: Maximum number of messages to send, or |none|
+* |on-completion|: Comma separated list of actions to run when the queue ends or reaches the maximum number of sends: |archive| it, |delete| it and |notify| the owners, or |none|
+* |low-water|: Alert the owners when the pending messages (like |5|) or the days of content at the current schedule (like |3d|) go below this threshold, and when the queue runs out of messages, or |none|
+* |catch-up|: What to do with the executions missed while the plugin was not running: |skip| them or |send| one message when the plugin starts, or |default| to use the policy configured in the System Console
+* |owners|: Comma separated list of users (like |@alice,@bob|) that receive the queue notifications, or |none| to notify only the creator of the queue
+* |channel|: Channel where the queue sends the messages, like |~town-square|, or |here| for the current channel
+
+###### Import format:
+* The format is taken from the file extension, or from the |--format| option: |csv|, |json| or |markdown|
+* |csv|: One message per row. If the first row has a |message| column it's used as header, and the rest of the columns are stored as metadata
+* |json|: A list of messages, each of them a string or an object with |message|, |metadata|, |props| (like message attachments) and |file_ids| fields
+* |markdown|: The messages are separated by lines with only |---|, or if there are no separators, each heading starts a new message
+* The exports can be imported too, when they have several queues only the messages of the queue with the same name are imported
+
+###### Message variables:
+* The messages can include variables that are replaced when the message is sent: |{{date}}| (or with a format like |{{date "Monday, January 2"}}|), |{{time}}|, |{{weekday}}|, |{{channel}}|, |{{members}}|, |{{randomMember}}| and |{{daysUntil "2026-12-25"}}|, and in the queue messages |{{position}}| and |{{remaining}}|
+* The dates are in the queue timezone. Any other text between braces, like |{{ .Values.image }}|, is kept as it is
 
 ###### Queue names:
 * The queue names must can be anything without spaces in it`
@@ -539,3 +1386,152 @@ func (p *Plugin) executeQueueHelpCommand(c *plugin.Context, args *model.CommandA
 
 	return &model.CommandResponse{}, nil
 }
+
+func (p *Plugin) executeQueueCalendarCommand(c *plugin.Context, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	split := parseCommand(args.Command).Values()
+	if len(split) < 3 {
+		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+			ChannelId: args.ChannelId,
+			Message:   "Not enough arguments to manage the calendars",
+		})
+		return &model.CommandResponse{}, nil
+	}
+
+	if split[2] == "list" {
+		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+			ChannelId: args.ChannelId,
+			Message:   p.describeCalendars(),
+		})
+		return &model.CommandResponse{}, nil
+	}
+
+	if len(split) < 4 {
+		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+			ChannelId: args.ChannelId,
+			Message:   "Not enough arguments to manage the calendar",
+		})
+		return &model.CommandResponse{}, nil
+	}
+	name := split[3]
+
+	if split[2] == "create" {
+		if _, ok := p.Calendars[name]; ok {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("Calendar %s already exists", name),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		p.Calendars[name] = &Calendar{Name: name, Ranges: []*DateRange{}}
+		nErr := p.SaveCalendars()
+		if nErr != nil {
+			p.API.LogError(nErr.Error())
+		}
+		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+			ChannelId: args.ChannelId,
+			Message:   fmt.Sprintf("Calendar %s created", name),
+		})
+		return &model.CommandResponse{}, nil
+	}
+
+	calendar, ok := p.Calendars[name]
+	if !ok {
+		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+			ChannelId: args.ChannelId,
+			Message:   fmt.Sprintf("Unknown calendar %s.", name),
+		})
+		return &model.CommandResponse{}, nil
+	}
+
+	response := ""
+	switch split[2] {
+	case "delete":
+		delete(p.Calendars, name)
+		for _, queue := range p.Queues {
+			calendars := []string{}
+			for _, calendarName := range queue.Calendars {
+				if calendarName != name {
+					calendars = append(calendars, calendarName)
+				}
+			}
+			queue.Calendars = calendars
+		}
+		nErr := p.SaveQueues()
+		if nErr != nil {
+			p.API.LogError(nErr.Error())
+		}
+		response = fmt.Sprintf("Calendar %s deleted", name)
+	case "add", "remove":
+		if len(split) < 5 {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   "Not enough arguments to manage the calendar dates",
+			})
+			return &model.CommandResponse{}, nil
+		}
+		dateRange, err := parseDateRange(split[4])
+		if err != nil {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("Unable to parse the dates: %s", err.Error()),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		if split[2] == "add" {
+			calendar.AddRanges(dateRange)
+			response = fmt.Sprintf("Dates %s added to the calendar %s", dateRange, name)
+		} else if calendar.RemoveRange(dateRange) {
+			response = fmt.Sprintf("Dates %s removed from the calendar %s", dateRange, name)
+		} else {
+			response = fmt.Sprintf("Dates %s not found in the calendar %s", dateRange, name)
+		}
+	case "import":
+		if len(split) < 5 {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   "Not enough arguments to import the calendar",
+			})
+			return &model.CommandResponse{}, nil
+		}
+		attachments, err := p.getPostAttachments(args.UserId, split[4], "ics")
+		if err != nil {
+			_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+				ChannelId: args.ChannelId,
+				Message:   fmt.Sprintf("Unable to import the calendar: %s", err.Error()),
+			})
+			return &model.CommandResponse{}, nil
+		}
+		added := 0
+		for _, attachment := range attachments {
+			ranges, err := parseICS(attachment.Data)
+			if err != nil {
+				_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+					ChannelId: args.ChannelId,
+					Message:   fmt.Sprintf("Unable to import the calendar %s: %s", attachment.Info.Name, err.Error()),
+				})
+				return &model.CommandResponse{}, nil
+			}
+			added += calendar.AddRanges(ranges...)
+		}
+		response = fmt.Sprintf("%d dates imported to the calendar %s", added, name)
+	default:
+		_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+			ChannelId: args.ChannelId,
+			Message:   "Unknown command, please use /" + queueCommand + " help for more information.",
+		})
+		return &model.CommandResponse{}, nil
+	}
+
+	nErr := p.SaveCalendars()
+	if nErr != nil {
+		p.API.LogError(nErr.Error())
+	}
+	for _, queue := range p.Queues {
+		p.scheduleQueue(queue)
+	}
+	_ = p.API.SendEphemeralPost(args.UserId, &model.Post{
+		ChannelId: args.ChannelId,
+		Message:   response,
+	})
+	return &model.CommandResponse{}, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"reflect"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -18,6 +19,191 @@ import (
 // If you add non-reference types to your configuration struct, be sure to rewrite Clone as a deep
 // copy appropriate for your types.
 type configuration struct {
+	// QueueManagers are the users allowed to manage the queues, besides the
+	// system admins: system_admins, channel_admins or channel_members.
+	QueueManagers string
+	// MaxQueueLength limits the pending messages of each queue, 0 is no limit.
+	MaxQueueLength int
+	// MaxPendingDeferredPosts limits the pending deferred posts of each user,
+	// 0 is no limit.
+	MaxPendingDeferredPosts int
+	// MaxPendingDeferredPostsPerChannel limits the pending deferred posts of
+	// each channel, 0 is no limit.
+	MaxPendingDeferredPostsPerChannel int
+	// MaxDeferPostsPerHour limits how many posts each user can defer in an
+	// hour, 0 is no limit.
+	MaxDeferPostsPerHour int
+	// ExemptSystemAdminsFromLimits makes the deferred posts limits not apply
+	// to the system admins.
+	ExemptSystemAdminsFromLimits bool
+	// MaxDeferHorizon limits how far in the future the posts can be deferred,
+	// like 72h. Empty is no limit.
+	MaxDeferHorizon string
+	// DefaultTimezone is the timezone of the new queues created by users
+	// without a valid timezone. When it's empty the server local time is used.
+	DefaultTimezone string
+	// DefaultCatchUpPolicy is the catch up policy of the queues that don't
+	// set their own one.
+	DefaultCatchUpPolicy string
+	// EnableOnlineDeferral allows deferring posts until the user is online.
+	EnableOnlineDeferral bool
+	// OnlineDeferralMaxWait is how long the posts wait for the user to be
+	// online by default, like 168h. Empty is forever.
+	OnlineDeferralMaxWait string
+	// OnlineDeferralFallback is what happens by default with the posts that
+	// wait too long: send, cancel or return.
+	OnlineDeferralFallback string
+	// OnlineDeliveryGracePeriod is how long the users have to be active
+	// before the posts waiting for them are sent, like 5m.
+	OnlineDeliveryGracePeriod string
+	// OnlineDeliveryInterval is the time between the posts sent to a user
+	// that comes online, like 10s. Empty sends them all at once.
+	OnlineDeliveryInterval string
+	// ShowOnlineComposeTime adds to the posts waiting for the user to be
+	// online, or held during quiet hours, when they were written.
+	ShowOnlineComposeTime bool
+	// EnableQuietHours allows the users to hold the direct messages sent to
+	// them during their quiet hours.
+	EnableQuietHours bool
+	// UrgentKeyword makes the direct messages that include it skip the quiet
+	// hours. Empty disables it.
+	UrgentKeyword string
+	// InvalidAuthorPolicy is what happens with the deferred posts and the
+	// queues when their author can't post anymore: cancel or reassign.
+	InvalidAuthorPolicy string
+	// DeactivatedUserPolicy is what happens with the deferred posts and the
+	// queues of the deactivated users: keep, cancel or transfer.
+	DeactivatedUserPolicy string
+
+	// maxDeferHorizon is the parsed MaxDeferHorizon.
+	maxDeferHorizon time.Duration
+	// onlineDeferralMaxWait is the parsed OnlineDeferralMaxWait.
+	onlineDeferralMaxWait time.Duration
+	// onlineDeliveryGracePeriod is the parsed OnlineDeliveryGracePeriod.
+	onlineDeliveryGracePeriod time.Duration
+	// onlineDeliveryInterval is the parsed OnlineDeliveryInterval.
+	onlineDeliveryInterval time.Duration
+}
+
+const (
+	queueManagersSystemAdmins   = "system_admins"
+	queueManagersChannelAdmins  = "channel_admins"
+	queueManagersChannelMembers = "channel_members"
+)
+
+const (
+	catchUpPolicySkip = "skip"
+	catchUpPolicySend = "send"
+)
+
+const (
+	invalidAuthorPolicyCancel   = "cancel"
+	invalidAuthorPolicyReassign = "reassign"
+)
+
+const (
+	onlineFallbackSend   = "send"
+	onlineFallbackCancel = "cancel"
+	onlineFallbackReturn = "return"
+)
+
+func isOnlineFallback(fallback string) bool {
+	return fallback == onlineFallbackSend || fallback == onlineFallbackCancel || fallback == onlineFallbackReturn
+}
+
+const (
+	deactivatedUserPolicyKeep     = "keep"
+	deactivatedUserPolicyCancel   = "cancel"
+	deactivatedUserPolicyTransfer = "transfer"
+)
+
+// defaultConfiguration returns the configuration used until the server
+// configuration is loaded, with the same defaults as the plugin manifest.
+func defaultConfiguration() *configuration {
+	return &configuration{
+		QueueManagers:                queueManagersSystemAdmins,
+		ExemptSystemAdminsFromLimits: true,
+		DefaultCatchUpPolicy:         catchUpPolicySkip,
+		EnableOnlineDeferral:         true,
+		OnlineDeferralFallback:       onlineFallbackReturn,
+		EnableQuietHours:             true,
+		UrgentKeyword:                "!urgent",
+		InvalidAuthorPolicy:          invalidAuthorPolicyCancel,
+		DeactivatedUserPolicy:        deactivatedUserPolicyKeep,
+	}
+}
+
+// IsValid checks the configuration and computes the parsed values.
+func (c *configuration) IsValid() error {
+	switch c.QueueManagers {
+	case "":
+		c.QueueManagers = queueManagersSystemAdmins
+	case queueManagersSystemAdmins, queueManagersChannelAdmins, queueManagersChannelMembers:
+	default:
+		return errors.Errorf("invalid queue managers %s", c.QueueManagers)
+	}
+	switch c.DefaultCatchUpPolicy {
+	case "":
+		c.DefaultCatchUpPolicy = catchUpPolicySkip
+	case catchUpPolicySkip, catchUpPolicySend:
+	default:
+		return errors.Errorf("invalid catch up policy %s", c.DefaultCatchUpPolicy)
+	}
+	switch c.InvalidAuthorPolicy {
+	case "":
+		c.InvalidAuthorPolicy = invalidAuthorPolicyCancel
+	case invalidAuthorPolicyCancel, invalidAuthorPolicyReassign:
+	default:
+		return errors.Errorf("invalid author policy %s", c.InvalidAuthorPolicy)
+	}
+	switch c.DeactivatedUserPolicy {
+	case "":
+		c.DeactivatedUserPolicy = deactivatedUserPolicyKeep
+	case deactivatedUserPolicyKeep, deactivatedUserPolicyCancel, deactivatedUserPolicyTransfer:
+	default:
+		return errors.Errorf("invalid deactivated user policy %s", c.DeactivatedUserPolicy)
+	}
+	if c.MaxQueueLength < 0 || c.MaxPendingDeferredPosts < 0 ||
+		c.MaxPendingDeferredPostsPerChannel < 0 || c.MaxDeferPostsPerHour < 0 {
+		return errors.New("the limits can't be negative")
+	}
+	var err error
+	if c.maxDeferHorizon, err = parseSettingDuration(c.MaxDeferHorizon); err != nil {
+		return errors.Errorf("invalid maximum defer time %s, use a duration like 72h", c.MaxDeferHorizon)
+	}
+	if c.OnlineDeferralFallback == "" {
+		c.OnlineDeferralFallback = onlineFallbackReturn
+	} else if !isOnlineFallback(c.OnlineDeferralFallback) {
+		return errors.Errorf("invalid online deferral fallback %s", c.OnlineDeferralFallback)
+	}
+	if c.onlineDeferralMaxWait, err = parseSettingDuration(c.OnlineDeferralMaxWait); err != nil {
+		return errors.Errorf("invalid online deferral maximum wait %s, use a duration like 168h", c.OnlineDeferralMaxWait)
+	}
+	if c.onlineDeliveryGracePeriod, err = parseSettingDuration(c.OnlineDeliveryGracePeriod); err != nil {
+		return errors.Errorf("invalid online delivery grace period %s, use a duration like 5m", c.OnlineDeliveryGracePeriod)
+	}
+	if c.onlineDeliveryInterval, err = parseSettingDuration(c.OnlineDeliveryInterval); err != nil {
+		return errors.Errorf("invalid online delivery interval %s, use a duration like 10s", c.OnlineDeliveryInterval)
+	}
+	if c.DefaultTimezone != "" {
+		if _, err := time.LoadLocation(c.DefaultTimezone); err != nil {
+			return errors.Errorf("invalid default timezone %s", c.DefaultTimezone)
+		}
+	}
+	return nil
+}
+
+// parseSettingDuration parses a duration setting, which is zero when it's
+// empty and can't be negative.
+func parseSettingDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, errors.Errorf("invalid duration %s", value)
+	}
+	return duration, nil
 }
 
 // Clone shallow copies the configuration. Your implementation may require a deep copy if
@@ -35,7 +221,7 @@ func (p *Plugin) getConfiguration() *configuration {
 	defer p.configurationLock.RUnlock()
 
 	if p.configuration == nil {
-		return &configuration{}
+		return defaultConfiguration()
 	}
 
 	return p.configuration
@@ -70,12 +256,15 @@ func (p *Plugin) setConfiguration(configuration *configuration) {
 
 // OnConfigurationChange is invoked when configuration changes may have been made.
 func (p *Plugin) OnConfigurationChange() error {
-	var configuration = new(configuration)
+	var configuration = defaultConfiguration()
 
 	// Load the public configuration fields from the Mattermost server configuration.
 	if err := p.API.LoadPluginConfiguration(configuration); err != nil {
 		return errors.Wrap(err, "failed to load plugin configuration")
 	}
+	if err := configuration.IsValid(); err != nil {
+		return errors.Wrap(err, "invalid plugin configuration")
+	}
 
 	p.setConfiguration(configuration)
 
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigurationIsValid(t *testing.T) {
+	config := &configuration{MaxDeferHorizon: "72h", DefaultTimezone: "Europe/Madrid", OnlineDeferralMaxWait: "168h"}
+	require.NoError(t, config.IsValid())
+	assert.Equal(t, queueManagersSystemAdmins, config.QueueManagers)
+	assert.Equal(t, catchUpPolicySkip, config.DefaultCatchUpPolicy)
+	assert.Equal(t, invalidAuthorPolicyCancel, config.InvalidAuthorPolicy)
+	assert.Equal(t, deactivatedUserPolicyKeep, config.DeactivatedUserPolicy)
+	assert.Equal(t, 72*time.Hour, config.maxDeferHorizon)
+	assert.Equal(t, 168*time.Hour, config.onlineDeferralMaxWait)
+	assert.Equal(t, onlineFallbackReturn, config.OnlineDeferralFallback)
+
+	assert.Error(t, (&configuration{QueueManagers: "everyone"}).IsValid())
+	assert.Error(t, (&configuration{DefaultCatchUpPolicy: "all"}).IsValid())
+	assert.Error(t, (&configuration{InvalidAuthorPolicy: "ignore"}).IsValid())
+	assert.Error(t, (&configuration{DeactivatedUserPolicy: "delete"}).IsValid())
+	assert.Error(t, (&configuration{MaxDeferHorizon: "3 days"}).IsValid())
+	assert.Error(t, (&configuration{OnlineDeferralMaxWait: "-1h"}).IsValid())
+	assert.Error(t, (&configuration{OnlineDeferralFallback: "ignore"}).IsValid())
+	assert.Error(t, (&configuration{DefaultTimezone: "Mars/Olympus"}).IsValid())
+	assert.Error(t, (&configuration{MaxQueueLength: -1}).IsValid())
+	assert.Error(t, (&configuration{MaxDeferPostsPerHour: -1}).IsValid())
+}
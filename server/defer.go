@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// onlineExpiresAtProp is the post prop with the time, in milliseconds,
+	// when a post stops waiting for the user to be online.
+	onlineExpiresAtProp = "messages_queue_expires_at"
+	// onlineFallbackProp is the post prop with what happens with the post
+	// when it expires.
+	onlineFallbackProp = "messages_queue_fallback"
+	// onlineComposedAtProp is the post prop with the time, in milliseconds,
+	// when the post was deferred.
+	onlineComposedAtProp = "messages_queue_composed_at"
+)
+
+// onlineDeferral is how long a post waits for the other user to be online,
+// and what happens with it after that time.
+type onlineDeferral struct {
+	MaxWait  time.Duration
+	Fallback string
+}
+
+// Set changes the option with the given name, max-wait or fallback.
+func (o *onlineDeferral) Set(name string, value string) error {
+	switch name {
+	case "max-wait":
+		maxWait, err := time.ParseDuration(value)
+		if err != nil || maxWait <= 0 {
+			return errors.Errorf("Invalid maximum wait %s, use a duration like 72h", value)
+		}
+		o.MaxWait = maxWait
+	case "fallback":
+		if !isOnlineFallback(value) {
+			return errors.Errorf("Invalid fallback %s, the valid ones are %s, %s and %s", value, onlineFallbackSend, onlineFallbackCancel, onlineFallbackReturn)
+		}
+		o.Fallback = value
+	default:
+		return errors.Errorf("Unknown option --%s", name)
+	}
+	return nil
+}
+
+// deferPostUntilOnline keeps the post until the other user of the direct
+// channel is online, or until the maximum wait of the options, or of the
+// configuration, has passed. The maximum wait of the options can't exceed the
+// maximum defer horizon.
+func (p *Plugin) deferPostUntilOnline(post *model.Post, options *onlineDeferral) error {
+	config := p.getConfiguration()
+	if !config.EnableOnlineDeferral {
+		return errors.New("Deferring messages until the user is online is disabled")
+	}
+	maxWait, fallback := config.onlineDeferralMaxWait, config.OnlineDeferralFallback
+	if options != nil && options.MaxWait > 0 {
+		if config.maxDeferHorizon > 0 && options.MaxWait > config.maxDeferHorizon {
+			return errors.Errorf("Messages can't wait more than %s", config.maxDeferHorizon)
+		}
+		maxWait = options.MaxWait
+	}
+	if options != nil && options.Fallback != "" {
+		fallback = options.Fallback
+	}
+
+	channel, appErr := p.API.GetChannel(post.ChannelId)
+	if appErr != nil {
+		return errors.New("Unable to defer the message until the user is online")
+	}
+	if channel.Type != model.CHANNEL_DIRECT {
+		return errors.New("Unable to defer the message until the user is online in not DMs channels")
+	}
+
+	members, appErr := p.API.GetChannelMembers(post.ChannelId, 0, 10)
+	if appErr != nil {
+		p.API.LogError("unable to get channel members of the channel", "err", appErr.Error())
+		return errors.New("Unable to defer the message until the user is online")
+	}
+
+	otherUserId := ""
+	for _, member := range *members {
+		if member.UserId != post.UserId {
+			otherUserId = member.UserId
+		}
+	}
+
+	if err := p.checkDeferLimits(post); err != nil {
+		return err
+	}
+	post.Id = model.NewId()
+	post.AddProp(onlineComposedAtProp, model.GetMillis())
+	if maxWait > 0 {
+		post.AddProp(onlineExpiresAtProp, model.GetMillisForTime(time.Now().Add(maxWait)))
+		post.AddProp(onlineFallbackProp, fallback)
+		p.scheduleOnlineExpiry(post.Id, maxWait)
+	}
+	p.postsWaitingForOnline[otherUserId] = append(p.postsWaitingForOnline[otherUserId], post)
+	p.SaveWaitingForOnlinePosts()
+	return nil
+}
+
+// postPropTime returns the time, in milliseconds, stored in the post prop,
+// or the zero time if it's not set. The prop is a float64 once the post is
+// restored from the KV store.
+func postPropTime(post *model.Post, key string) time.Time {
+	switch millis := post.GetProp(key).(type) {
+	case int64:
+		return millisToTime(millis)
+	case float64:
+		return millisToTime(int64(millis))
+	}
+	return time.Time{}
+}
+
+// scheduleOnlineExpiry expires the post waiting for the user to be online
+// with the given id after the duration, unless it's sent or cancelled before.
+func (p *Plugin) scheduleOnlineExpiry(id string, duration time.Duration) {
+	model.CreateTask("expire online deferral", func() {
+		p.stateLock.Lock()
+		defer p.stateLock.Unlock()
+		p.expireWaitingForOnlinePost(id)
+	}, duration)
+}
+
+// expireWaitingForOnlinePost stops waiting for the user to be online and
+// sends, cancels or returns the post to its author depending on its
+// fallback.
+func (p *Plugin) expireWaitingForOnlinePost(id string) {
+	post := p.removeWaitingForOnlinePost(id)
+	if post == nil {
+		return
+	}
+	p.SaveWaitingForOnlinePosts()
+	switch post.GetProp(onlineFallbackProp) {
+	case onlineFallbackSend:
+		p.createDeferredPost(post)
+	case onlineFallbackCancel:
+		p.notifyUser(post.UserId, fmt.Sprintf("Your deferred message was cancelled because the other user wasn't online in time:\n%s", previewMessage(post.Message)))
+	default:
+		p.notifyUser(post.UserId, fmt.Sprintf("Your deferred message wasn't sent because the other user wasn't online in time. This was the message:\n\n%s", post.Message))
+	}
+}
+
+// deferPost sends the post after the duration.
+func (p *Plugin) deferPost(post *model.Post, duration time.Duration) error {
+	if horizon := p.getConfiguration().maxDeferHorizon; horizon > 0 && duration > horizon {
+		return errors.Errorf("Messages can't be deferred more than %s", horizon)
+	}
+	if err := p.checkDeferLimits(post); err != nil {
+		return err
+	}
+	post.Id = model.NewId()
+	p.deferredPosts = append(p.deferredPosts, &DeferredPost{Time: time.Now().Add(duration), Post: post})
+	p.SaveDeferredPosts()
+	p.scheduleDeferredPost(post.Id, duration)
+	return nil
+}
+
+// scheduleDeferredPost sends the deferred post with the given id after the
+// duration, unless it's cancelled before.
+func (p *Plugin) scheduleDeferredPost(id string, duration time.Duration) {
+	model.CreateTask("defer message", func() {
+		p.stateLock.Lock()
+		defer p.stateLock.Unlock()
+		deferredPost := p.removeDeferredPost(id)
+		if deferredPost == nil {
+			return
+		}
+		p.SaveDeferredPosts()
+		p.createDeferredPost(deferredPost.Post)
+	}, duration)
+}
+
+// removeDeferredPost removes the deferred post with the given id, and
+// returns it, or nil if it's not pending.
+func (p *Plugin) removeDeferredPost(id string) *DeferredPost {
+	for idx, deferredPost := range p.deferredPosts {
+		if deferredPost.Post.Id == id {
+			p.deferredPosts = append(p.deferredPosts[:idx:idx], p.deferredPosts[idx+1:]...)
+			return deferredPost
+		}
+	}
+	return nil
+}
+
+// removeWaitingForOnlinePost removes the post with the given id from the
+// posts waiting for users to be online, and returns it, or nil if it's not
+// pending.
+func (p *Plugin) removeWaitingForOnlinePost(id string) *model.Post {
+	for userID, posts := range p.postsWaitingForOnline {
+		for idx, post := range posts {
+			if post.Id == id {
+				p.postsWaitingForOnline[userID] = append(posts[:idx:idx], posts[idx+1:]...)
+				return post
+			}
+		}
+	}
+	return nil
+}
+
+// createDeferredPost sends the deferred post, if the channel is available and
+// its author can still post in it. The post id and the online deferral props
+// are only used by the plugin, so they are cleared.
+func (p *Plugin) createDeferredPost(post *model.Post) {
+	if err := p.checkChannelAvailable(post.ChannelId); err != nil {
+		p.cancelDeferredPostForChannel(post, err)
+		return
+	}
+	authorID, err := p.deliveryAuthor(post.UserId, post.ChannelId)
+	if err != nil {
+		p.notifyUser(post.UserId, fmt.Sprintf("Your deferred message was cancelled because %s:\n%s", err.Error(), previewMessage(post.Message)))
+		return
+	}
+	rendered := p.renderDeferredPost(post).Clone()
+	rendered.Id = ""
+	rendered.DelProp(onlineExpiresAtProp)
+	rendered.DelProp(onlineFallbackProp)
+	rendered.DelProp(onlineComposedAtProp)
+	if authorID != post.UserId {
+		rendered.UserId = authorID
+		rendered.Message = strings.TrimSpace(rendered.Message + "\n\n" + p.onBehalfOf(post.UserId))
+	}
+	if _, appErr := p.API.CreatePost(rendered); appErr != nil {
+		p.API.LogError("failed to send the deferred post", "err", appErr.Error())
+	}
+}
+
+// checkDeferLimits returns an error if the post author can't defer one more
+// post, because of the pending posts of the user or the channel, or because
+// of the rate limit. The system admins can be exempted from the limits.
+// Allowed posts count for the rate limit, so it must be the last check before
+// deferring the post.
+func (p *Plugin) checkDeferLimits(post *model.Post) error {
+	config := p.getConfiguration()
+	if config.ExemptSystemAdminsFromLimits && p.isSystemAdmin(post.UserId) {
+		return nil
+	}
+	if config.MaxPendingDeferredPosts > 0 && p.countPendingDeferredPosts(post.UserId) >= config.MaxPendingDeferredPosts {
+		return errors.Errorf("You can't have more than %d deferred messages pending, wait for some of them to be sent", config.MaxPendingDeferredPosts)
+	}
+	maxPerChannel := config.MaxPendingDeferredPostsPerChannel
+	if maxPerChannel > 0 && p.countChannelPendingDeferredPosts(post.ChannelId) >= maxPerChannel {
+		return errors.Errorf("This channel can't have more than %d deferred messages pending, wait for some of them to be sent", maxPerChannel)
+	}
+	maxPerHour := config.MaxDeferPostsPerHour
+	if maxPerHour > 0 && !p.deferRateLimiter.Allow(post.UserId, maxPerHour, time.Hour, time.Now()) {
+		return errors.Errorf("You can't defer more than %d messages per hour, try again later", maxPerHour)
+	}
+	return nil
+}
+
+// countPendingDeferredPosts returns the number of deferred posts of the user
+// not sent yet, including the ones waiting for other users to be online.
+func (p *Plugin) countPendingDeferredPosts(userID string) int {
+	count := 0
+	now := time.Now()
+	for _, deferredPost := range p.deferredPosts {
+		if deferredPost.Post.UserId == userID && deferredPost.Time.After(now) {
+			count++
+		}
+	}
+	for _, posts := range p.postsWaitingForOnline {
+		for _, post := range posts {
+			if post.UserId == userID {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// countChannelPendingDeferredPosts returns the number of deferred posts of
+// the channel not sent yet, including the ones waiting for users to be online.
+func (p *Plugin) countChannelPendingDeferredPosts(channelID string) int {
+	count := 0
+	now := time.Now()
+	for _, deferredPost := range p.deferredPosts {
+		if deferredPost.Post.ChannelId == channelID && deferredPost.Time.After(now) {
+			count++
+		}
+	}
+	for _, posts := range p.postsWaitingForOnline {
+		for _, post := range posts {
+			if post.ChannelId == channelID {
+				count++
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveDeferredPost(t *testing.T) {
+	p := &Plugin{
+		deferredPosts: []*DeferredPost{
+			{Time: time.Now(), Post: &model.Post{Id: "post1"}},
+			{Time: time.Now(), Post: &model.Post{Id: "post2"}},
+		},
+		postsWaitingForOnline: map[string][]*model.Post{
+			"user1": {{Id: "post3"}, {Id: "post4"}},
+		},
+	}
+
+	removed := p.removeDeferredPost("post1")
+	require.NotNil(t, removed)
+	assert.Equal(t, "post1", removed.Post.Id)
+	assert.Len(t, p.deferredPosts, 1)
+	assert.Nil(t, p.removeDeferredPost("post1"))
+	assert.Nil(t, p.removeDeferredPost("post3"))
+
+	waiting := p.removeWaitingForOnlinePost("post3")
+	require.NotNil(t, waiting)
+	assert.Equal(t, "post3", waiting.Id)
+	assert.Equal(t, []*model.Post{{Id: "post4"}}, p.postsWaitingForOnline["user1"])
+	assert.Nil(t, p.removeWaitingForOnlinePost("post2"))
+}
+
+func TestOnlineDeferralSet(t *testing.T) {
+	options := &onlineDeferral{}
+	require.NoError(t, options.Set("max-wait", "72h"))
+	require.NoError(t, options.Set("fallback", onlineFallbackCancel))
+	assert.Equal(t, &onlineDeferral{MaxWait: 72 * time.Hour, Fallback: onlineFallbackCancel}, options)
+
+	assert.Error(t, options.Set("max-wait", "3 days"))
+	assert.Error(t, options.Set("max-wait", "-1h"))
+	assert.Error(t, options.Set("fallback", "ignore"))
+	assert.Error(t, options.Set("urgent", ""))
+}
+
+func TestPostPropTime(t *testing.T) {
+	expiresAt := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	post := &model.Post{}
+	assert.True(t, postPropTime(post, onlineExpiresAtProp).IsZero())
+
+	post.AddProp(onlineExpiresAtProp, model.GetMillisForTime(expiresAt))
+	assert.True(t, expiresAt.Equal(postPropTime(post, onlineExpiresAtProp)))
+
+	restored := model.PostFromJson(strings.NewReader(post.ToJson()))
+	assert.True(t, expiresAt.Equal(postPropTime(restored, onlineExpiresAtProp)))
+}
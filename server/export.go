@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	exportFormatJSON     = "json"
+	exportFormatMarkdown = "markdown"
+)
+
+// queueModeFIFO is the only queue mode, the messages are sent in order.
+const queueModeFIFO = "fifo"
+
+// QueueExport is the exported representation of a queue, with its settings
+// and pending messages.
+type QueueExport struct {
+	Name           string          `json:"name"`
+	Schedule       string          `json:"schedule"`
+	Mode           string          `json:"mode"`
+	Timezone       string          `json:"timezone,omitempty"`
+	ChannelID      string          `json:"channel_id"`
+	Calendars      []string        `json:"calendars,omitempty"`
+	BlackoutPolicy string          `json:"blackout_policy,omitempty"`
+	StartsAt       int64           `json:"starts_at,omitempty"`
+	EndsAt         int64           `json:"ends_at,omitempty"`
+	MaxSends       int             `json:"max_sends,omitempty"`
+	OnCompletion   []string        `json:"on_completion,omitempty"`
+	LowWater       int             `json:"low_water,omitempty"`
+	LowWaterUnit   string          `json:"low_water_unit,omitempty"`
+	CatchUpPolicy  string          `json:"catch_up_policy,omitempty"`
+	Paused         bool            `json:"paused,omitempty"`
+	Messages       []*QueueMessage `json:"messages,omitempty"`
+}
+
+// QueuesExport is the document generated by the export, that can be used to
+// import the messages again.
+type QueuesExport struct {
+	Queues []*QueueExport `json:"queues"`
+}
+
+func newQueueExport(queue *Queue) *QueueExport {
+	return &QueueExport{
+		Name:           queue.Name,
+		Schedule:       queue.SpecSource,
+		Mode:           queueModeFIFO,
+		Timezone:       queue.Timezone,
+		ChannelID:      queue.ChannelId,
+		Calendars:      queue.Calendars,
+		BlackoutPolicy: queue.BlackoutPolicy,
+		StartsAt:       queue.StartsAt,
+		EndsAt:         queue.EndsAt,
+		MaxSends:       queue.MaxSends,
+		OnCompletion:   queue.OnCompletion,
+		LowWater:       queue.LowWater,
+		LowWaterUnit:   queue.LowWaterUnit,
+		CatchUpPolicy:  queue.CatchUpPolicy,
+		Paused:         queue.Paused,
+		Messages:       queue.Messages,
+	}
+}
+
+// exportQueues generates the export of the queues in the given format, and
+// returns it together with a file name for it. The queues are sorted by name.
+func exportQueues(queues []*Queue, format string) ([]byte, string, error) {
+	queues = append([]*Queue{}, queues...)
+	sort.Slice(queues, func(i, j int) bool {
+		return queues[i].Name < queues[j].Name
+	})
+	document := &QueuesExport{Queues: []*QueueExport{}}
+	for _, queue := range queues {
+		document.Queues = append(document.Queues, newQueueExport(queue))
+	}
+
+	filename := "queues"
+	if len(queues) == 1 {
+		filename = queues[0].Name
+	}
+
+	switch format {
+	case exportFormatJSON, "":
+		data, err := json.MarshalIndent(document, "", "  ")
+		if err != nil {
+			return nil, "", err
+		}
+		return data, filename + ".json", nil
+	case exportFormatMarkdown:
+		data, err := exportMarkdown(document)
+		if err != nil {
+			return nil, "", err
+		}
+		return data, filename + ".md", nil
+	}
+	return nil, "", fmt.Errorf("unknown format %q, the supported formats are json and markdown", format)
+}
+
+// exportMarkdown generates a markdown document where each queue starts with
+// a comment with its settings, and the messages are separated by lines with
+// only "---". The metadata of each message is stored in a comment before the
+// message, and the messages that can't be split back from the document are
+// stored completely in a comment.
+func exportMarkdown(document *QueuesExport) ([]byte, error) {
+	sections := []string{}
+	for _, queue := range document.Queues {
+		settings := *queue
+		settings.Messages = nil
+		data, err := json.Marshal(settings)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, markdownQueuePrefix+string(data)+markdownCommentSuffix)
+		for _, message := range queue.Messages {
+			text := message.Message
+			if !isMarkdownSafe(text) || message.hasPayload() {
+				data, err := json.Marshal(&QueueMessage{Message: message.Message, Metadata: message.Metadata, Props: message.Props, FileIds: message.FileIds})
+				if err != nil {
+					return nil, err
+				}
+				sections = append(sections, markdownMessagePrefix+string(data)+markdownCommentSuffix)
+				continue
+			}
+			if len(message.Metadata) > 0 {
+				metadata, err := json.Marshal(message.Metadata)
+				if err != nil {
+					return nil, err
+				}
+				text = markdownMetadataPrefix + string(metadata) + markdownCommentSuffix + "\n" + text
+			}
+			sections = append(sections, text)
+		}
+	}
+	return []byte(strings.Join(sections, "\n---\n") + "\n"), nil
+}
+
+// isMarkdownSafe returns true if the message can be written as is in a
+// markdown export and read back without changes.
+func isMarkdownSafe(message string) bool {
+	if message != strings.Trim(message, "\n") || strings.Contains(message, "```") || strings.HasPrefix(message, "<!--") {
+		return false
+	}
+	for _, line := range strings.Split(message, "\n") {
+		if strings.TrimSpace(line) == "---" {
+			return false
+		}
+	}
+	return true
+}
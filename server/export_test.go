@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportQueues(t *testing.T) {
+	queues := []*Queue{
+		{
+			Name:       "tips",
+			SpecSource: "0 10 * * 1-5",
+			ChannelId:  "channel",
+			Messages: []*QueueMessage{
+				{ID: "aaaaaa", Message: "# Tip 1\n\nfirst\n---\nstill first", Metadata: map[string]string{"category": "tips"}},
+				{ID: "bbbbbb", Message: "second"},
+				{ID: "dddddd", Message: "with files", FileIds: []string{"file"}},
+			},
+		},
+		{
+			Name:       "news",
+			SpecSource: "@daily",
+			ChannelId:  "channel",
+			Messages:   []*QueueMessage{{ID: "cccccc", Message: "news"}},
+		},
+	}
+
+	t.Run("json", func(t *testing.T) {
+		data, filename, err := exportQueues(queues, exportFormatJSON)
+		require.NoError(t, err)
+		assert.Equal(t, "queues.json", filename)
+
+		messages, err := parseImport(data, importFormatJSON, "tips")
+		require.NoError(t, err)
+		assert.Equal(t, queues[0].Messages, messages)
+		messages, err = parseImport(data, importFormatJSON, "news")
+		require.NoError(t, err)
+		assert.Equal(t, queues[1].Messages, messages)
+		_, err = parseImport(data, importFormatJSON, "other")
+		assert.Error(t, err)
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		data, filename, err := exportQueues(queues[:1], exportFormatMarkdown)
+		require.NoError(t, err)
+		assert.Equal(t, "tips.md", filename)
+
+		messages, err := parseImport(data, importFormatMarkdown, "other")
+		require.NoError(t, err)
+		assert.Equal(t, []*QueueMessage{
+			{Message: "# Tip 1\n\nfirst\n---\nstill first", Metadata: map[string]string{"category": "tips"}},
+			{Message: "second"},
+			{Message: "with files", FileIds: []string{"file"}},
+		}, messages)
+
+		data, _, err = exportQueues(queues, exportFormatMarkdown)
+		require.NoError(t, err)
+		messages, err = parseImport(data, importFormatMarkdown, "news")
+		require.NoError(t, err)
+		assert.Equal(t, []*QueueMessage{{Message: "news"}}, messages)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, _, err := exportQueues(queues, "xml")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// maxQueueHistory is the number of delivered messages kept in the history of
+// each queue.
+const maxQueueHistory = 50
+
+// QueueHistoryItem is a message delivered by a queue.
+type QueueHistoryItem struct {
+	ID      string        `json:"id"`
+	Message *QueueMessage `json:"message"`
+	SentAt  int64         `json:"sent_at"`
+	PostID  string        `json:"post_id"`
+}
+
+func (q *Queue) newHistoryID() string {
+	for {
+		id := model.NewId()[:queueMessageIDLength]
+		if _, ok := q.FindHistoryItem(id); !ok {
+			return id
+		}
+	}
+}
+
+// FindHistoryItem returns the delivered message with the given id.
+func (q *Queue) FindHistoryItem(id string) (*QueueHistoryItem, bool) {
+	for _, item := range q.History {
+		if item.ID == id {
+			return item, true
+		}
+	}
+	return nil, false
+}
+
+// addHistoryItem records the delivery of the message, discarding the oldest
+// items when the history is full.
+func (q *Queue) addHistoryItem(message *QueueMessage, post *model.Post) *QueueHistoryItem {
+	item := &QueueHistoryItem{
+		ID:      q.newHistoryID(),
+		Message: message,
+		SentAt:  post.CreateAt,
+		PostID:  post.Id,
+	}
+	q.History = append(q.History, item)
+	if len(q.History) > maxQueueHistory {
+		q.History = q.History[len(q.History)-maxQueueHistory:]
+	}
+	return item
+}
+
+// sendQueueMessage posts the message in the queue channel as the given user
+// and records it in the queue history.
+func (p *Plugin) sendQueueMessage(queue *Queue, message *QueueMessage, authorID string) (*model.Post, *model.AppError) {
+	remaining := len(queue.Messages)
+	if idx, ok := queue.messageIndexByID(message.ID); ok {
+		remaining = len(queue.Messages) - idx - 1
+	}
+	text, err := p.renderMessage(message.Message, &messageTemplateContext{
+		Now:       time.Now().In(queue.Location()),
+		ChannelID: queue.ChannelId,
+		Queued:    true,
+		Position:  queue.Sends + 1,
+		Remaining: remaining,
+	})
+	if err != nil {
+		p.API.LogError("failed to render the queue message", "queue", queue.Name, "err", err.Error())
+	}
+	post := &model.Post{
+		UserId:    authorID,
+		ChannelId: queue.ChannelId,
+		Message:   text,
+		FileIds:   p.copyFiles(authorID, message.FileIds),
+	}
+	for key, value := range message.Props {
+		post.AddProp(key, value)
+	}
+	post, appErr := p.API.CreatePost(post)
+	if appErr != nil {
+		return nil, appErr
+	}
+	queue.addHistoryItem(message, post)
+	return post, nil
+}
+
+// describeQueueHistory returns the delivered messages of the queue, from the
+// newest to the oldest.
+func (p *Plugin) describeQueueHistory(queue *Queue) string {
+	if len(queue.History) == 0 {
+		return fmt.Sprintf("The queue %s hasn't sent any message yet", queue.Name)
+	}
+	lines := []string{fmt.Sprintf("#### Sent messages of the queue %s:", queue.Name)}
+	for i := len(queue.History) - 1; i >= 0; i-- {
+		item := queue.History[i]
+		sentAt := millisToTime(item.SentAt).In(queue.Location()).Format(executionTimeFormat)
+		if link := p.postPermalink(item.PostID); link != "" {
+			sentAt = fmt.Sprintf("[%s](%s)", sentAt, link)
+		}
+		lines = append(lines, fmt.Sprintf(" * **%s** (%s): %s", item.ID, sentAt, item.Message.Message))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueHistoryLimit(t *testing.T) {
+	queue := &Queue{}
+	for i := 0; i < maxQueueHistory+5; i++ {
+		queue.addHistoryItem(&QueueMessage{Message: fmt.Sprintf("message %d", i)}, &model.Post{Id: fmt.Sprintf("post%d", i)})
+	}
+
+	require.Len(t, queue.History, maxQueueHistory)
+	assert.Equal(t, "message 5", queue.History[0].Message.Message)
+	assert.Equal(t, fmt.Sprintf("message %d", maxQueueHistory+4), queue.History[maxQueueHistory-1].Message.Message)
+
+	item, ok := queue.FindHistoryItem(queue.History[10].ID)
+	assert.True(t, ok)
+	assert.Equal(t, "post15", item.PostID)
+	_, ok = queue.FindHistoryItem("unknown")
+	assert.False(t, ok)
+}
+
+// newHistoryTestPlugin returns a plugin with the queue tips, which already
+// sent the message first, and the API calls of the queue commands mocked.
+func newHistoryTestPlugin(t *testing.T) (*Plugin, *plugintest.API) {
+	api := &plugintest.API{}
+	api.On("HasPermissionTo", "user1", model.PERMISSION_MANAGE_SYSTEM).Return(true)
+	api.On("KVSet", "queues", mock.Anything).Return(nil)
+	api.On("SendEphemeralPost", "user1", mock.Anything).Return(&model.Post{})
+	api.On("GetUser", "author").Return(&model.User{Id: "author", Username: "author"}, nil)
+	api.On("HasPermissionToChannel", "author", "channel1", model.PERMISSION_CREATE_POST).Return(true)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", Name: "town-square"}, nil)
+
+	p := &Plugin{botUserID: "bot"}
+	p.SetAPI(api)
+	queue := &Queue{Name: "tips", UserId: "author", ChannelId: "channel1"}
+	queue.addHistoryItem(&QueueMessage{ID: "msg1", Message: "first"}, &model.Post{Id: "post1", CreateAt: 1})
+	p.Queues = map[string]*Queue{"tips": queue}
+	return p, api
+}
+
+func TestResendQueueMessage(t *testing.T) {
+	p, api := newHistoryTestPlugin(t)
+	queue := p.Queues["tips"]
+	api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.UserId == "author" && post.ChannelId == "channel1" && post.Message == "first"
+	})).Return(&model.Post{Id: "post2", CreateAt: 2}, nil)
+
+	_, appErr := p.executeQueueCommand(nil, &model.CommandArgs{UserId: "user1", ChannelId: "channel2", Command: "/queue resend tips " + queue.History[0].ID})
+	require.Nil(t, appErr)
+
+	api.AssertExpectations(t)
+	require.Len(t, queue.History, 2)
+	assert.Equal(t, "post2", queue.History[1].PostID)
+	assert.Empty(t, queue.Messages)
+}
+
+func TestResendQueueMessageAsBot(t *testing.T) {
+	p, api := newHistoryTestPlugin(t)
+	p.setConfiguration(&configuration{InvalidAuthorPolicy: invalidAuthorPolicyReassign})
+	queue := p.Queues["tips"]
+	queue.UserId = "former"
+	queue.History[0].Message.FileIds = []string{"file1"}
+	api.On("GetUser", "former").Return(&model.User{Id: "former", Username: "former", DeleteAt: 1}, nil)
+	api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	api.On("CopyFileInfos", "bot", []string{"file1"}).Return([]string{"copy1"}, nil)
+	api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.UserId == "bot" && post.FileIds[0] == "copy1"
+	})).Return(&model.Post{Id: "post2", CreateAt: 2}, nil)
+
+	_, appErr := p.executeQueueCommand(nil, &model.CommandArgs{UserId: "user1", ChannelId: "channel2", Command: "/queue resend tips " + queue.History[0].ID})
+	require.Nil(t, appErr)
+
+	api.AssertCalled(t, "CopyFileInfos", "bot", []string{"file1"})
+	require.Len(t, queue.History, 2)
+	assert.Equal(t, "post2", queue.History[1].PostID)
+}
+
+func TestResendQueueMessageToArchivedChannel(t *testing.T) {
+	p, api := newHistoryTestPlugin(t)
+	queue := p.Queues["tips"]
+	queue.ChannelId = "archived"
+	api.On("GetChannel", "archived").Return(&model.Channel{Id: "archived", Name: "old-news", DeleteAt: 1}, nil)
+
+	_, appErr := p.executeQueueCommand(nil, &model.CommandArgs{UserId: "user1", ChannelId: "channel2", Command: "/queue resend tips " + queue.History[0].ID})
+	require.Nil(t, appErr)
+
+	api.AssertCalled(t, "SendEphemeralPost", "user1", mock.MatchedBy(func(post *model.Post) bool {
+		return post.Message == "Unable to resend the message: the channel ~old-news was archived"
+	}))
+	api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	assert.Len(t, queue.History, 1)
+}
+
+func TestRequeueQueueMessage(t *testing.T) {
+	p, api := newHistoryTestPlugin(t)
+	queue := p.Queues["tips"]
+
+	_, appErr := p.executeQueueCommand(nil, &model.CommandArgs{UserId: "user1", ChannelId: "channel2", Command: "/queue requeue tips " + queue.History[0].ID})
+	require.Nil(t, appErr)
+
+	api.AssertCalled(t, "KVSet", "queues", mock.Anything)
+
+	require.Len(t, queue.Messages, 1)
+	assert.Equal(t, "first", queue.Messages[0].Message)
+	assert.Equal(t, "user1", queue.Messages[0].CreatedBy)
+	assert.NotEqual(t, "msg1", queue.Messages[0].ID)
+	assert.Len(t, queue.History, 1)
+}
+
+func TestResendUnknownHistoryItem(t *testing.T) {
+	p, api := newHistoryTestPlugin(t)
+
+	_, appErr := p.executeQueueCommand(nil, &model.CommandArgs{UserId: "user1", ChannelId: "channel2", Command: "/queue resend tips unknown"})
+	require.Nil(t, appErr)
+
+	api.AssertCalled(t, "SendEphemeralPost", "user1", mock.MatchedBy(func(post *model.Post) bool {
+		return post.Message == "Invalid history id, please see the history command result."
+	}))
+	api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	assert.Len(t, p.Queues["tips"].History, 1)
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	importFormatCSV      = "csv"
+	importFormatJSON     = "json"
+	importFormatMarkdown = "markdown"
+)
+
+var markdownHeadingRegexp = regexp.MustCompile(`^#{1,6}\s`)
+
+// Comments used in the markdown exports for the queue settings and the
+// messages metadata.
+const (
+	markdownQueuePrefix    = "<!-- queue: "
+	markdownMetadataPrefix = "<!-- metadata: "
+	markdownMessagePrefix  = "<!-- message: "
+	markdownCommentSuffix  = " -->"
+)
+
+// maxImportMessages limits the number of messages imported at once.
+const maxImportMessages = 1000
+
+// importPreviewLength is the number of characters of each message shown in
+// the import summary.
+const importPreviewLength = 80
+
+// importFormatFromFilename guesses the import format from the file extension.
+func importFormatFromFilename(filename string) string {
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), ".")) {
+	case "csv":
+		return importFormatCSV
+	case "json":
+		return importFormatJSON
+	case "md", "markdown", "txt":
+		return importFormatMarkdown
+	}
+	return ""
+}
+
+// parseImport parses the messages of a file in the given format. The
+// messages don't have ID, author or creation time yet. If the file is an
+// export with several queues, only the messages of the queue with the given
+// name are returned.
+func parseImport(data []byte, format string, queueName string) ([]*QueueMessage, error) {
+	var messages []*QueueMessage
+	var err error
+	switch format {
+	case importFormatCSV:
+		messages, err = parseCSVImport(data)
+	case importFormatJSON:
+		messages, err = parseJSONImport(data, queueName)
+	case importFormatMarkdown:
+		messages, err = parseMarkdownImport(data, queueName)
+	default:
+		return nil, errors.Errorf("unknown format %q, the supported formats are csv, json and markdown", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*QueueMessage{}
+	for _, message := range messages {
+		if !message.isEmpty() {
+			result = append(result, message)
+		}
+	}
+	for idx, message := range result {
+		if err := validateMessageTemplate(message.Message, true); err != nil {
+			return nil, errors.Wrapf(err, "message %d", idx)
+		}
+	}
+	if len(result) == 0 {
+		return nil, errors.New("no messages found in the file")
+	}
+	if len(result) > maxImportMessages {
+		return nil, errors.Errorf("too many messages, the maximum is %d per import", maxImportMessages)
+	}
+	return result, nil
+}
+
+// parseCSVImport reads one message per row. If the first row has a
+// "message" column it's used as header, and the rest of the columns are
+// stored as metadata of the messages.
+func parseCSVImport(data []byte) ([]*QueueMessage, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid CSV file")
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	messageColumn := 0
+	header := []string(nil)
+	for idx, column := range records[0] {
+		if strings.EqualFold(strings.TrimSpace(column), "message") {
+			messageColumn = idx
+			header = records[0]
+			records = records[1:]
+			break
+		}
+	}
+
+	messages := []*QueueMessage{}
+	for _, record := range records {
+		if messageColumn >= len(record) {
+			continue
+		}
+		message := &QueueMessage{Message: record[messageColumn]}
+		for idx, value := range record {
+			if idx == messageColumn || idx >= len(header) || value == "" {
+				continue
+			}
+			if message.Metadata == nil {
+				message.Metadata = map[string]string{}
+			}
+			message.Metadata[strings.TrimSpace(header[idx])] = value
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// parseJSONImport reads a list of messages, each of them a string or an
+// object like the exported messages, an object with a "messages" list, or an
+// export document.
+func parseJSONImport(data []byte, queueName string) ([]*QueueMessage, error) {
+	var messages []*QueueMessage
+	if err := json.Unmarshal(data, &messages); err == nil {
+		return messages, nil
+	}
+	var document struct {
+		Messages []*QueueMessage `json:"messages"`
+		Queues   []*QueueExport  `json:"queues"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, errors.Wrap(err, "invalid JSON file")
+	}
+	if document.Queues == nil {
+		return document.Messages, nil
+	}
+	queue, err := findExportedQueue(document.Queues, queueName)
+	if err != nil {
+		return nil, err
+	}
+	return queue.Messages, nil
+}
+
+// findExportedQueue returns the queue of an export with the given name, or
+// the only queue of the export.
+func findExportedQueue(queues []*QueueExport, queueName string) (*QueueExport, error) {
+	for _, queue := range queues {
+		if queue.Name == queueName {
+			return queue, nil
+		}
+	}
+	if len(queues) == 1 {
+		return queues[0], nil
+	}
+	return nil, errors.Errorf("the file doesn't have a queue named %s", queueName)
+}
+
+// parseMarkdownImport splits the document in messages using the lines with
+// only "---" as separators. If there are no separators, each heading starts
+// a new message. The queue settings and the messages metadata of markdown
+// exports are read from their comments.
+func parseMarkdownImport(data []byte, queueName string) ([]*QueueMessage, error) {
+	text := strings.Replace(string(data), "\r\n", "\n", -1)
+	lines := strings.Split(text, "\n")
+
+	hasSeparators := false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "---" {
+			hasSeparators = true
+			break
+		}
+	}
+
+	queues := []*QueueExport{}
+	messages := []*QueueMessage{}
+	current := []string{}
+	flush := func() error {
+		message := strings.Trim(strings.Join(current, "\n"), "\n")
+		current = []string{}
+		if strings.TrimSpace(message) == "" {
+			return nil
+		}
+		if strings.HasPrefix(message, markdownQueuePrefix) && strings.HasSuffix(message, markdownCommentSuffix) {
+			queue := &QueueExport{}
+			settings := strings.TrimSuffix(strings.TrimPrefix(message, markdownQueuePrefix), markdownCommentSuffix)
+			if err := json.Unmarshal([]byte(settings), queue); err != nil {
+				return errors.Wrap(err, "invalid queue settings")
+			}
+			queues = append(queues, queue)
+			return nil
+		}
+		queueMessage := &QueueMessage{Message: message}
+		if strings.HasPrefix(message, markdownMessagePrefix) && strings.HasSuffix(message, markdownCommentSuffix) {
+			encoded := strings.TrimSuffix(strings.TrimPrefix(message, markdownMessagePrefix), markdownCommentSuffix)
+			if err := json.Unmarshal([]byte(encoded), queueMessage); err != nil {
+				return errors.Wrap(err, "invalid message")
+			}
+		} else if strings.HasPrefix(message, markdownMetadataPrefix) {
+			parts := strings.SplitN(message, "\n", 2)
+			metadata := strings.TrimSuffix(strings.TrimPrefix(parts[0], markdownMetadataPrefix), markdownCommentSuffix)
+			if err := json.Unmarshal([]byte(metadata), &queueMessage.Metadata); err != nil {
+				return errors.Wrap(err, "invalid message metadata")
+			}
+			queueMessage.Message = ""
+			if len(parts) == 2 {
+				queueMessage.Message = parts[1]
+			}
+		}
+		if len(queues) > 0 {
+			queue := queues[len(queues)-1]
+			queue.Messages = append(queue.Messages, queueMessage)
+		} else {
+			messages = append(messages, queueMessage)
+		}
+		return nil
+	}
+	inCodeBlock := false
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCodeBlock = !inCodeBlock
+		}
+		switch {
+		case inCodeBlock:
+		case hasSeparators && strings.TrimSpace(line) == "---":
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		case !hasSeparators && markdownHeadingRegexp.MatchString(line):
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+		current = append(current, line)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	if len(queues) == 0 {
+		return messages, nil
+	}
+	queue, err := findExportedQueue(queues, queueName)
+	if err != nil {
+		return nil, err
+	}
+	return queue.Messages, nil
+}
+
+// importSummary returns a readable summary of the messages to import.
+func importSummary(queue *Queue, messages []*QueueMessage, dryRun bool) string {
+	lines := []string{}
+	if dryRun {
+		lines = append(lines, fmt.Sprintf("#### %d messages will be added to the queue %s:", len(messages), queue.Name))
+	} else {
+		lines = append(lines, fmt.Sprintf("#### %d messages added to the queue %s:", len(messages), queue.Name))
+	}
+	for idx, message := range messages {
+		lines = append(lines, fmt.Sprintf(" * **%d**: %s", len(queue.Messages)+idx, previewMessage(message.Message)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// previewMessage returns the first line of the message, truncated.
+func previewMessage(message string) string {
+	preview := strings.TrimSpace(strings.SplitN(strings.TrimSpace(message), "\n", 2)[0])
+	if runes := []rune(preview); len(runes) > importPreviewLength {
+		preview = string(runes[:importPreviewLength]) + "…"
+	}
+	if preview != strings.TrimSpace(message) && !strings.HasSuffix(preview, "…") {
+		preview += " …"
+	}
+	return preview
+}
+
+// importQueueMessages adds the imported messages at the end of the queue.
+func (p *Plugin) importQueueMessages(queue *Queue, messages []*QueueMessage, userID string) {
+	for _, imported := range messages {
+		message := queue.NewMessage(imported.Message, userID)
+		message.Metadata = imported.Metadata
+		message.Props = imported.Props
+		message.FileIds = imported.FileIds
+		queue.Messages = append(queue.Messages, message)
+	}
+	p.checkQueueLowWater(queue)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImport(t *testing.T) {
+	t.Run("csv with header", func(t *testing.T) {
+		messages, err := parseImport([]byte("category,message\ntips,\"Take breaks,\nplease\"\n,Drink water\n"), importFormatCSV, "tips")
+		require.NoError(t, err)
+		assert.Equal(t, []*QueueMessage{
+			{Message: "Take breaks,\nplease", Metadata: map[string]string{"category": "tips"}},
+			{Message: "Drink water"},
+		}, messages)
+	})
+
+	t.Run("csv without header", func(t *testing.T) {
+		messages, err := parseImport([]byte("first\nsecond\n"), importFormatCSV, "tips")
+		require.NoError(t, err)
+		assert.Equal(t, []*QueueMessage{{Message: "first"}, {Message: "second"}}, messages)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		messages, err := parseImport([]byte(`["first", {"message": "second", "metadata": {"a": "b"}}]`), importFormatJSON, "tips")
+		require.NoError(t, err)
+		assert.Equal(t, []*QueueMessage{{Message: "first"}, {Message: "second", Metadata: map[string]string{"a": "b"}}}, messages)
+
+		messages, err = parseImport([]byte(`{"messages": ["first"]}`), importFormatJSON, "tips")
+		require.NoError(t, err)
+		assert.Equal(t, []*QueueMessage{{Message: "first"}}, messages)
+
+		messages, err = parseImport([]byte(`[{"props": {"attachments": [{"text": "card"}]}, "file_ids": ["file"]}, {"message": " "}]`), importFormatJSON, "tips")
+		require.NoError(t, err)
+		require.Len(t, messages, 1)
+		assert.Equal(t, []string{"file"}, messages[0].FileIds)
+		assert.Equal(t, "(1 attachments, 1 files)", messages[0].describePayload())
+	})
+
+	t.Run("markdown with separators", func(t *testing.T) {
+		messages, err := parseImport([]byte("# Tip 1\n\nfirst  tip\n---\n```\n---\n```\n"), importFormatMarkdown, "tips")
+		require.NoError(t, err)
+		assert.Equal(t, []*QueueMessage{{Message: "# Tip 1\n\nfirst  tip"}, {Message: "```\n---\n```"}}, messages)
+	})
+
+	t.Run("markdown with headings", func(t *testing.T) {
+		messages, err := parseImport([]byte("# Tip 1\nfirst\n\n# Tip 2\n| a | b |\n|---|---|\n"), importFormatMarkdown, "tips")
+		require.NoError(t, err)
+		assert.Equal(t, []*QueueMessage{{Message: "# Tip 1\nfirst"}, {Message: "# Tip 2\n| a | b |\n|---|---|"}}, messages)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := parseImport([]byte("first"), "xml", "tips")
+		assert.Error(t, err)
+		_, err = parseImport([]byte("\n\n"), importFormatMarkdown, "tips")
+		assert.Error(t, err)
+		_, err = parseImport([]byte("{"), importFormatJSON, "tips")
+		assert.Error(t, err)
+	})
+}
+
+func TestCheckImportedPayloads(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("GetFileInfo", "own").Return(&model.FileInfo{Id: "own", CreatorId: "user1"}, nil)
+	api.On("GetFileInfo", "shared").Return(&model.FileInfo{Id: "shared", CreatorId: "user2", PostId: "post1"}, nil)
+	api.On("GetFileInfo", "foreign").Return(&model.FileInfo{Id: "foreign", CreatorId: "user2", PostId: "post2"}, nil)
+	api.On("GetFileInfo", "unattached").Return(&model.FileInfo{Id: "unattached", CreatorId: "user2"}, nil)
+	api.On("GetPost", "post1").Return(&model.Post{Id: "post1", ChannelId: "public"}, nil)
+	api.On("GetPost", "post2").Return(&model.Post{Id: "post2", ChannelId: "private"}, nil)
+	api.On("HasPermissionToChannel", "user1", "public", model.PERMISSION_READ_CHANNEL).Return(true)
+	api.On("HasPermissionToChannel", "user1", "private", model.PERMISSION_READ_CHANNEL).Return(false)
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	messages, err := parseImport([]byte(`[{"message": "hi", "props": {"from_webhook": "true", "override_username": "ceo", "attachments": []}, "file_ids": ["own", "shared"]}]`), importFormatJSON, "tips")
+	require.NoError(t, err)
+	require.NoError(t, p.checkImportedPayloads("user1", messages))
+	assert.Equal(t, model.StringInterface{"attachments": []interface{}{}}, messages[0].Props)
+	assert.Equal(t, []string{"own", "shared"}, messages[0].FileIds)
+
+	for _, fileID := range []string{"foreign", "unattached", "unknown"} {
+		if fileID == "unknown" {
+			api.On("GetFileInfo", "unknown").Return(nil, &model.AppError{Message: "not found"})
+		}
+		messages, err = parseImport([]byte(`[{"message": "hi", "file_ids": ["own", "`+fileID+`"]}]`), importFormatJSON, "tips")
+		require.NoError(t, err)
+		assert.Error(t, p.checkImportedPayloads("user1", messages), fileID)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	lowWaterUnitMessages = "messages"
+	lowWaterUnitDays     = "days"
+)
+
+// parseLowWater parses a low water threshold, which is a number of pending
+// messages (like 5) or a number of days of content at the current schedule
+// (like 3d or 3 days).
+func parseLowWater(value string) (int, string, error) {
+	value = strings.TrimSpace(value)
+	unit := lowWaterUnitMessages
+	for _, suffix := range []string{" days", " day", "d"} {
+		if strings.HasSuffix(value, suffix) {
+			value = strings.TrimSuffix(value, suffix)
+			unit = lowWaterUnitDays
+			break
+		}
+	}
+	value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(value, " messages"), " message"))
+	threshold, err := strconv.Atoi(value)
+	if err != nil || threshold < 1 {
+		return 0, "", errors.Errorf("invalid threshold %q, use a number of messages (like 5) or days (like 3d)", value)
+	}
+	return threshold, unit, nil
+}
+
+// remainingContent returns how long the pending messages of the queue last at
+// the current schedule, and false if the queue completes before running out
+// of messages.
+func (p *Plugin) remainingContent(queue *Queue, now time.Time) (time.Duration, bool) {
+	if len(queue.Messages) == 0 {
+		return 0, true
+	}
+	executions := p.nextQueueExecutions(queue, now, len(queue.Messages))
+	if len(executions) < len(queue.Messages) {
+		return 0, false
+	}
+	return executions[len(executions)-1].Sub(now), true
+}
+
+// isQueueLowWater returns true if the pending content of the queue is below
+// its low water threshold.
+func (p *Plugin) isQueueLowWater(queue *Queue, now time.Time) bool {
+	if queue.LowWater == 0 {
+		return false
+	}
+	if queue.LowWaterUnit == lowWaterUnitDays {
+		remaining, runsOut := p.remainingContent(queue, now)
+		return runsOut && remaining < time.Duration(queue.LowWater)*24*time.Hour
+	}
+	return len(queue.Messages) < queue.LowWater
+}
+
+// checkQueueLowWater notifies the queue owners when the queue goes below its
+// low water threshold and when it runs out of messages. Each alert is sent
+// once, until the queue gets enough messages again.
+func (p *Plugin) checkQueueLowWater(queue *Queue) {
+	if queue.LowWater == 0 {
+		return
+	}
+	now := time.Now()
+
+	if len(queue.Messages) > 0 {
+		queue.EmptyAlert = false
+	} else if !queue.EmptyAlert {
+		queue.EmptyAlert = true
+		queue.LowWaterAlert = true
+		p.notifyQueueOwners(queue, fmt.Sprintf("The queue **%s** has run out of messages, so nothing will be posted until new messages are added.", queue.Name))
+		return
+	}
+
+	if !p.isQueueLowWater(queue, now) {
+		queue.LowWaterAlert = false
+		return
+	}
+	if queue.LowWaterAlert {
+		return
+	}
+	queue.LowWaterAlert = true
+
+	remaining := ""
+	if duration, runsOut := p.remainingContent(queue, now); runsOut {
+		remaining = fmt.Sprintf(", enough until %s", now.Add(duration).In(queue.Location()).Format(executionTimeFormat))
+	}
+	p.notifyQueueOwners(queue, fmt.Sprintf("The queue **%s** is running low, it only has %d pending messages%s.", queue.Name, len(queue.Messages), remaining))
+}
+
+// notifyQueueOwners sends the message to the queue owners, with a link to
+// the queue channel to add more messages.
+func (p *Plugin) notifyQueueOwners(queue *Queue, message string) {
+	message += fmt.Sprintf("\nYou can add more messages running `/%s add-message %s <message>`", queueCommand, queue.Name)
+	if link := p.channelLink(queue.ChannelId); link != "" {
+		message += fmt.Sprintf(" in the [queue channel](%s)", link)
+	}
+	message += "."
+	for _, userID := range queue.Owners() {
+		p.notifyUser(userID, message)
+	}
+}
@@ -31,7 +31,222 @@ const manifestStr = `
   "settings_schema": {
     "header": "",
     "footer": "",
-    "settings": []
+    "settings": [
+      {
+        "key": "QueueManagers",
+        "display_name": "Queue managers:",
+        "type": "dropdown",
+        "help_text": "Users allowed to manage the messages queues. System admins can always manage all the queues, channel admins and channel members can only manage the queues of their channels.",
+        "placeholder": "",
+        "default": "system_admins",
+        "options": [
+          {
+            "display_name": "System admins",
+            "value": "system_admins"
+          },
+          {
+            "display_name": "Channel admins",
+            "value": "channel_admins"
+          },
+          {
+            "display_name": "Channel members",
+            "value": "channel_members"
+          }
+        ]
+      },
+      {
+        "key": "MaxQueueLength",
+        "display_name": "Maximum queue length:",
+        "type": "number",
+        "help_text": "Maximum number of pending messages of each queue. Use 0 for no limit.",
+        "placeholder": "",
+        "default": 0
+      },
+      {
+        "key": "MaxPendingDeferredPosts",
+        "display_name": "Maximum pending deferred posts per user:",
+        "type": "number",
+        "help_text": "Maximum number of deferred posts, including the ones waiting for the user to be online, that each user can have pending. Use 0 for no limit.",
+        "placeholder": "",
+        "default": 0
+      },
+      {
+        "key": "MaxPendingDeferredPostsPerChannel",
+        "display_name": "Maximum pending deferred posts per channel:",
+        "type": "number",
+        "help_text": "Maximum number of deferred posts, including the ones waiting for the user to be online, that each channel can have pending. Use 0 for no limit.",
+        "placeholder": "",
+        "default": 0
+      },
+      {
+        "key": "MaxDeferPostsPerHour",
+        "display_name": "Maximum deferred posts per hour:",
+        "type": "number",
+        "help_text": "Maximum number of posts that each user can defer in an hour. Use 0 for no limit.",
+        "placeholder": "",
+        "default": 0
+      },
+      {
+        "key": "ExemptSystemAdminsFromLimits",
+        "display_name": "Exempt system admins from the deferred posts limits:",
+        "type": "bool",
+        "help_text": "When true, the system admins can defer posts without the per user, per channel and per hour limits.",
+        "placeholder": "",
+        "default": true
+      },
+      {
+        "key": "MaxDeferHorizon",
+        "display_name": "Maximum defer time:",
+        "type": "text",
+        "help_text": "How far in the future the posts can be deferred, and how long they can wait for the user to be online with --max-wait, like 72h. Leave it empty for no limit.",
+        "placeholder": "",
+        "default": ""
+      },
+      {
+        "key": "DefaultTimezone",
+        "display_name": "Default timezone:",
+        "type": "text",
+        "help_text": "Timezone of the new queues when the user that creates the queue doesn't have a valid timezone, like Europe/Madrid. Leave it empty to use the server local time.",
+        "placeholder": "",
+        "default": ""
+      },
+      {
+        "key": "DefaultCatchUpPolicy",
+        "display_name": "Default catch up policy:",
+        "type": "dropdown",
+        "help_text": "What the queues do with the executions missed while the plugin was not running: skip them, or send one message as soon as the plugin starts. Each queue can override it with its catch-up setting.",
+        "placeholder": "",
+        "default": "skip",
+        "options": [
+          {
+            "display_name": "Skip the missed executions",
+            "value": "skip"
+          },
+          {
+            "display_name": "Send one message",
+            "value": "send"
+          }
+        ]
+      },
+      {
+        "key": "EnableOnlineDeferral",
+        "display_name": "Enable deferring posts until the user is online:",
+        "type": "bool",
+        "help_text": "When false, /defer-post online is disabled.",
+        "placeholder": "",
+        "default": true
+      },
+      {
+        "key": "OnlineDeferralMaxWait",
+        "display_name": "Maximum wait for online users:",
+        "type": "text",
+        "help_text": "How long the posts deferred until the user is online wait by default, like 168h. Leave it empty to wait forever. Users can change it with the --max-wait option.",
+        "placeholder": "",
+        "default": ""
+      },
+      {
+        "key": "OnlineDeferralFallback",
+        "display_name": "After the maximum wait:",
+        "type": "dropdown",
+        "help_text": "What happens by default with the posts that wait too long for the user to be online. Users can change it with the --fallback option.",
+        "placeholder": "",
+        "default": "return",
+        "options": [
+          {
+            "display_name": "Return the message to its author",
+            "value": "return"
+          },
+          {
+            "display_name": "Send the message anyway",
+            "value": "send"
+          },
+          {
+            "display_name": "Cancel the message",
+            "value": "cancel"
+          }
+        ]
+      },
+      {
+        "key": "OnlineDeliveryGracePeriod",
+        "display_name": "Online delivery grace period:",
+        "type": "text",
+        "help_text": "How long the users have to be active before the posts waiting for them are sent, like 5m. Leave it empty to send them as soon as the users are online.",
+        "placeholder": "",
+        "default": ""
+      },
+      {
+        "key": "OnlineDeliveryInterval",
+        "display_name": "Online delivery interval:",
+        "type": "text",
+        "help_text": "Time between the posts sent to a user that comes online, like 10s. Leave it empty to send them all at once. The posts of each channel are sent together, in the order they were written.",
+        "placeholder": "",
+        "default": ""
+      },
+      {
+        "key": "ShowOnlineComposeTime",
+        "display_name": "Show when the online posts were written:",
+        "type": "bool",
+        "help_text": "When true, the posts sent when the user comes online, or when its quiet hours end, say when they were written.",
+        "placeholder": "",
+        "default": false
+      },
+      {
+        "key": "EnableQuietHours",
+        "display_name": "Enable quiet hours:",
+        "type": "bool",
+        "help_text": "When true, the users can hold the direct messages sent to them during their quiet hours with /defer-post quiet-hours and /defer-post hold.",
+        "placeholder": "",
+        "default": true
+      },
+      {
+        "key": "UrgentKeyword",
+        "display_name": "Urgent keyword:",
+        "type": "text",
+        "help_text": "The direct messages that include this keyword are delivered during the quiet hours. Leave it empty to hold all the direct messages.",
+        "placeholder": "",
+        "default": "!urgent"
+      },
+      {
+        "key": "InvalidAuthorPolicy",
+        "display_name": "When the author can't post anymore:",
+        "type": "dropdown",
+        "help_text": "What happens with the deferred posts and the queue messages when their author is deactivated or can't post in the channel anymore. The deferred posts are cancelled and the queues paused, notifying the authors and the queue owners, or they are sent by the plugin bot instead.",
+        "placeholder": "",
+        "default": "cancel",
+        "options": [
+          {
+            "display_name": "Cancel the deferred posts and pause the queues",
+            "value": "cancel"
+          },
+          {
+            "display_name": "Send them as the plugin bot",
+            "value": "reassign"
+          }
+        ]
+      },
+      {
+        "key": "DeactivatedUserPolicy",
+        "display_name": "Content of deactivated users:",
+        "type": "dropdown",
+        "help_text": "What happens, within an hour, with the deferred posts and the queues of the deactivated users. The posts waiting for a deactivated user to be online are always cancelled, notifying their authors.",
+        "placeholder": "",
+        "default": "keep",
+        "options": [
+          {
+            "display_name": "Keep them, and list them in /defer-post admin orphaned",
+            "value": "keep"
+          },
+          {
+            "display_name": "Cancel the deferred posts and pause the queues",
+            "value": "cancel"
+          },
+          {
+            "display_name": "Send the deferred posts as the plugin bot and transfer the queues to their other owners",
+            "value": "transfer"
+          }
+        ]
+      }
+    ]
   }
 }
 `
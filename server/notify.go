@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const botUsername = "messages-queue"
+
+// ensureBot creates, if needed, the bot used to send the plugin notifications.
+func (p *Plugin) ensureBot() error {
+	botUserID, err := p.Helpers.EnsureBot(&model.Bot{
+		Username:    botUsername,
+		DisplayName: "Messages Queue",
+		Description: "Notifications about the messages queues and the deferred posts.",
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to ensure the bot")
+	}
+	p.botUserID = botUserID
+	return nil
+}
+
+// notifyUser sends a direct message from the plugin bot to the user.
+func (p *Plugin) notifyUser(userID string, message string) {
+	channel, appErr := p.API.GetDirectChannel(userID, p.botUserID)
+	if appErr != nil {
+		p.API.LogError("failed to get the direct channel with the bot", "user_id", userID, "err", appErr.Error())
+		return
+	}
+	_, appErr = p.API.CreatePost(&model.Post{
+		UserId:    p.botUserID,
+		ChannelId: channel.Id,
+		Message:   message,
+	})
+	if appErr != nil {
+		p.API.LogError("failed to notify the user", "user_id", userID, "err", appErr.Error())
+	}
+}
+
+// channelLink returns the link to the channel, or an empty string if it
+// can't be built.
+func (p *Plugin) channelLink(channelID string) string {
+	siteURL := p.API.GetConfig().ServiceSettings.SiteURL
+	if siteURL == nil || *siteURL == "" {
+		return ""
+	}
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil || channel.TeamId == "" {
+		return ""
+	}
+	team, appErr := p.API.GetTeam(channel.TeamId)
+	if appErr != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/channels/%s", strings.TrimRight(*siteURL, "/"), team.Name, channel.Name)
+}
+
+// postPermalink returns the permanent link to the post, or an empty string if
+// it can't be built.
+func (p *Plugin) postPermalink(postID string) string {
+	siteURL := p.API.GetConfig().ServiceSettings.SiteURL
+	if siteURL == nil || *siteURL == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/_redirect/pl/%s", strings.TrimRight(*siteURL, "/"), postID)
+}
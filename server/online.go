@@ -0,0 +1,138 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// onlineActivityTimeout is how long without activity a user is considered
+// gone, so the grace period starts again. The webapp reports the activity at
+// most once a minute.
+const onlineActivityTimeout = 5 * time.Minute
+
+// onlineActivity tracks since when the users are active, and the users whose
+// waiting posts are being delivered.
+type onlineActivity struct {
+	mutex      sync.Mutex
+	since      map[string]time.Time
+	last       map[string]time.Time
+	delivering map[string]bool
+}
+
+// Seen records the activity of the user and returns true if its waiting
+// posts can be delivered, because the user has been active for the grace
+// period and they are not being delivered yet. In that case, the posts are
+// marked as being delivered.
+func (a *onlineActivity) Seen(userID string, now time.Time, gracePeriod time.Duration) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.since == nil {
+		a.since = map[string]time.Time{}
+		a.last = map[string]time.Time{}
+		a.delivering = map[string]bool{}
+	}
+	if last, ok := a.last[userID]; !ok || now.Sub(last) > onlineActivityTimeout {
+		a.since[userID] = now
+	}
+	a.last[userID] = now
+	if now.Sub(a.since[userID]) < gracePeriod || a.delivering[userID] {
+		return false
+	}
+	a.delivering[userID] = true
+	return true
+}
+
+// Delivered marks the posts of the user as not being delivered anymore.
+func (a *onlineActivity) Delivered(userID string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	delete(a.delivering, userID)
+}
+
+// deliverWaitingForOnlinePosts sends the posts waiting for the user, one
+// each delivery interval of the configuration, or all of them at once. Once
+// there are no more posts, they are marked as delivered.
+func (p *Plugin) deliverWaitingForOnlinePosts(userID string) {
+	config := p.getConfiguration()
+	for {
+		post := p.popWaitingForOnlinePost(userID)
+		if post == nil {
+			p.onlineActivity.Delivered(userID)
+			return
+		}
+		if config.ShowOnlineComposeTime {
+			post = p.withComposeTime(post, userID)
+		}
+		p.createDeferredPost(post)
+		if config.onlineDeliveryInterval > 0 {
+			model.CreateTask("online delivery", func() {
+				p.stateLock.Lock()
+				defer p.stateLock.Unlock()
+				p.deliverWaitingForOnlinePosts(userID)
+			}, config.onlineDeliveryInterval)
+			return
+		}
+	}
+}
+
+// popWaitingForOnlinePost removes and returns the next post to send to the
+// user, or nil if there are no more.
+func (p *Plugin) popWaitingForOnlinePost(userID string) *model.Post {
+	posts := orderWaitingForOnlinePosts(p.postsWaitingForOnline[userID])
+	if len(posts) == 0 {
+		return nil
+	}
+	p.postsWaitingForOnline[userID] = posts[1:]
+	if len(posts) == 1 {
+		p.postsWaitingForOnline[userID] = nil
+	}
+	p.SaveWaitingForOnlinePosts()
+	return posts[0]
+}
+
+// orderWaitingForOnlinePosts sorts the posts by the time they were deferred,
+// grouping the posts of each channel, so the conversations are delivered one
+// after the other.
+func orderWaitingForOnlinePosts(posts []*model.Post) []*model.Post {
+	sorted := make([]*model.Post, len(posts))
+	copy(sorted, posts)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return postPropTime(sorted[i], onlineComposedAtProp).Before(postPropTime(sorted[j], onlineComposedAtProp))
+	})
+
+	channels := []string{}
+	byChannel := map[string][]*model.Post{}
+	for _, post := range sorted {
+		if _, ok := byChannel[post.ChannelId]; !ok {
+			channels = append(channels, post.ChannelId)
+		}
+		byChannel[post.ChannelId] = append(byChannel[post.ChannelId], post)
+	}
+	ordered := make([]*model.Post, 0, len(posts))
+	for _, channelID := range channels {
+		ordered = append(ordered, byChannel[channelID]...)
+	}
+	return ordered
+}
+
+// withComposeTime returns a copy of the post that says when it was written,
+// in the timezone of the recipient.
+func (p *Plugin) withComposeTime(post *model.Post, recipientID string) *model.Post {
+	composedAt := postPropTime(post, onlineComposedAtProp)
+	if composedAt.IsZero() {
+		return post
+	}
+	if user, appErr := p.API.GetUser(recipientID); appErr == nil {
+		if loc, err := time.LoadLocation(user.GetPreferredTimezone()); err == nil {
+			composedAt = composedAt.In(loc)
+		}
+	}
+	withTime := post.Clone()
+	withTime.Message = strings.TrimSpace(withTime.Message + "\n\n_Written on " + composedAt.Format("Mon Jan 2 15:04 MST") + "_")
+	return withTime
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnlineActivitySeen(t *testing.T) {
+	activity := &onlineActivity{}
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	assert.False(t, activity.Seen("user1", now, 2*time.Minute))
+	assert.False(t, activity.Seen("user1", now.Add(time.Minute), 2*time.Minute))
+	assert.True(t, activity.Seen("user1", now.Add(2*time.Minute), 2*time.Minute))
+	assert.False(t, activity.Seen("user1", now.Add(3*time.Minute), 2*time.Minute), "the posts are being delivered")
+	activity.Delivered("user1")
+	assert.True(t, activity.Seen("user1", now.Add(4*time.Minute), 2*time.Minute))
+	activity.Delivered("user1")
+
+	assert.False(t, activity.Seen("user1", now.Add(time.Hour), 2*time.Minute), "the grace period starts again after inactivity")
+	assert.True(t, activity.Seen("user2", now, 0))
+}
+
+func TestOrderWaitingForOnlinePosts(t *testing.T) {
+	newPost := func(id string, channelID string, composedAt int64) *model.Post {
+		post := &model.Post{Id: id, ChannelId: channelID}
+		post.AddProp(onlineComposedAtProp, composedAt)
+		return post
+	}
+	posts := []*model.Post{
+		newPost("post1", "channel2", 3),
+		newPost("post2", "channel1", 2),
+		newPost("post3", "channel2", 1),
+		newPost("post4", "channel1", 4),
+	}
+
+	ids := []string{}
+	for _, post := range orderWaitingForOnlinePosts(posts) {
+		ids = append(ids, post.Id)
+	}
+	assert.Equal(t, []string{"post3", "post1", "post2", "post4"}, ids)
+	assert.Equal(t, "post1", posts[0].Id, "the original posts are not sorted")
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// ignoredPostProps are the props of a post that are not copied when the post
+// is enqueued or deferred, because they are set by the server.
+var ignoredPostProps = []string{
+	"from_bot",
+	"from_plugin",
+	"from_webhook",
+	"override_username",
+	"override_icon_url",
+	"webhook_display_name",
+}
+
+// copyPostPayload returns a new post with the message, props and files of the
+// referenced post, checking that the user can read it. The files are copied,
+// so they are still available if the original post is deleted.
+func (p *Plugin) copyPostPayload(userID string, ref string) (*model.Post, error) {
+	postID, err := postIDFromReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "unable to get the post")
+	}
+	if !p.API.HasPermissionToChannel(userID, post.ChannelId, model.PERMISSION_READ_CHANNEL) {
+		return nil, errors.New("unable to get the post")
+	}
+
+	payload := &model.Post{Message: post.Message}
+	for key, value := range post.GetProps() {
+		if !isIgnoredPostProp(key) {
+			payload.AddProp(key, value)
+		}
+	}
+	if len(post.FileIds) > 0 {
+		fileIds, appErr := p.API.CopyFileInfos(userID, post.FileIds)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "unable to copy the files of the post")
+		}
+		payload.FileIds = fileIds
+	}
+	return payload, nil
+}
+
+// checkImportedPayloads removes the props of the imported messages that are
+// set by the server, like copyPostPayload does, and returns an error if the
+// user can't read any of their files.
+func (p *Plugin) checkImportedPayloads(userID string, messages []*QueueMessage) error {
+	for idx, message := range messages {
+		for key := range message.Props {
+			if isIgnoredPostProp(key) {
+				delete(message.Props, key)
+			}
+		}
+		for _, fileID := range message.FileIds {
+			if !p.canReadFile(userID, fileID) {
+				return errors.Errorf("message %d: unable to get the file %s", idx, fileID)
+			}
+		}
+	}
+	return nil
+}
+
+// canReadFile returns true if the user uploaded the file, or if it's attached
+// to a post of a channel the user can read.
+func (p *Plugin) canReadFile(userID string, fileID string) bool {
+	info, appErr := p.API.GetFileInfo(fileID)
+	if appErr != nil {
+		return false
+	}
+	if info.CreatorId == userID {
+		return true
+	}
+	if info.PostId == "" {
+		return false
+	}
+	post, appErr := p.API.GetPost(info.PostId)
+	if appErr != nil {
+		return false
+	}
+	return p.API.HasPermissionToChannel(userID, post.ChannelId, model.PERMISSION_READ_CHANNEL)
+}
+
+// newDeferredPost returns the post to send later in the channel, and thread,
+// where the command was run, with the content of the payload.
+func newDeferredPost(payload *model.Post, args *model.CommandArgs) *model.Post {
+	post := payload.Clone()
+	post.UserId = args.UserId
+	post.ChannelId = args.ChannelId
+	post.RootId = args.RootId
+	post.ParentId = args.ParentId
+	return post
+}
+
+func isIgnoredPostProp(key string) bool {
+	for _, ignored := range ignoredPostProps {
+		if key == ignored {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPayload returns true if the message has something besides the text.
+func (m *QueueMessage) hasPayload() bool {
+	return len(m.Props) > 0 || len(m.FileIds) > 0
+}
+
+// isEmpty returns true if there is nothing to send in the message.
+func (m *QueueMessage) isEmpty() bool {
+	return strings.TrimSpace(m.Message) == "" && !m.hasPayload()
+}
+
+// describePayload returns a short description of the attachments and files
+// of the message, or an empty string if it doesn't have any.
+func (m *QueueMessage) describePayload() string {
+	parts := []string{}
+	if attachments, ok := m.Props["attachments"].([]interface{}); ok && len(attachments) > 0 {
+		parts = append(parts, fmt.Sprintf("%d attachments", len(attachments)))
+	}
+	if len(m.FileIds) > 0 {
+		parts = append(parts, fmt.Sprintf("%d files", len(m.FileIds)))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+// copyFiles returns a copy of the files of the post, so the same files can
+// be sent several times, because a file can only be attached to one post.
+func (p *Plugin) copyFiles(userID string, fileIds []string) []string {
+	if len(fileIds) == 0 {
+		return nil
+	}
+	copied, appErr := p.API.CopyFileInfos(userID, fileIds)
+	if appErr != nil {
+		p.API.LogError("failed to copy the post files", "err", appErr.Error())
+		return nil
+	}
+	return copied
+}
@@ -4,21 +4,43 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/gorhill/cronexpr"
 	"github.com/mattermost/mattermost-server/v5/model"
 	"github.com/mattermost/mattermost-server/v5/plugin"
 )
 
 type Queue struct {
-	Name       string               `json:"name"`
-	SpecSource string               `json:"spec_source"`
-	Spec       *cronexpr.Expression `json:"-"`
-	UserId     string               `json:"user_id"`
-	ChannelId  string               `json:"channel_id"`
-	Messages   []string             `json:"messages"`
+	Name           string              `json:"name"`
+	SpecSource     string              `json:"spec_source"`
+	Spec           Schedule            `json:"-"`
+	Timezone       string              `json:"timezone,omitempty"`
+	Calendars      []string            `json:"calendars,omitempty"`
+	BlackoutPolicy string              `json:"blackout_policy,omitempty"`
+	UserId         string              `json:"user_id"`
+	CreatedAt      int64               `json:"created_at,omitempty"`
+	StartsAt       int64               `json:"starts_at,omitempty"`
+	EndsAt         int64               `json:"ends_at,omitempty"`
+	MaxSends       int                 `json:"max_sends,omitempty"`
+	Sends          int                 `json:"sends,omitempty"`
+	OnCompletion   []string            `json:"on_completion,omitempty"`
+	CompletedAt    int64               `json:"completed_at,omitempty"`
+	Archived       bool                `json:"archived,omitempty"`
+	Paused         bool                `json:"paused,omitempty"`
+	CatchUpPolicy  string              `json:"catch_up_policy,omitempty"`
+	LastRunAt      int64               `json:"last_run_at,omitempty"`
+	OwnerIds       []string            `json:"owner_ids,omitempty"`
+	LowWater       int                 `json:"low_water,omitempty"`
+	LowWaterUnit   string              `json:"low_water_unit,omitempty"`
+	LowWaterAlert  bool                `json:"low_water_alert,omitempty"`
+	EmptyAlert     bool                `json:"empty_alert,omitempty"`
+	ChannelId      string              `json:"channel_id"`
+	Messages       []*QueueMessage     `json:"messages"`
+	History        []*QueueHistoryItem `json:"history,omitempty"`
+
+	task *model.ScheduledTask
 }
 
 type DeferredPost struct {
@@ -33,28 +55,75 @@ type Plugin struct {
 	// configurationLock synchronizes access to the configuration.
 	configurationLock sync.RWMutex
 
+	// stateLock synchronizes access to the queues, the calendars and the
+	// deferred posts, changed by the commands, the REST API and the scheduled
+	// tasks.
+	stateLock sync.Mutex
+
 	// configuration is the active plugin configuration. Consult getConfiguration and
 	// setConfiguration for usage.
 	configuration *configuration
 
+	// botUserID is the user used to send the plugin notifications.
+	botUserID string
+
+	// deferRateLimiter limits the posts each user can defer.
+	deferRateLimiter rateLimiter
+
+	// onlineActivity tracks since when the users are active.
+	onlineActivity onlineActivity
+
+	// quietLock synchronizes access to the quiet hours and the held posts,
+	// used by MessageWillBePosted for every post. It can be taken holding the
+	// state lock, but not the other way around, and it's never held while
+	// creating posts, as that runs MessageWillBePosted.
+	quietLock sync.Mutex
+
+	// heldReleaseTasks are the pending releases of the held posts of each
+	// user.
+	heldReleaseTasks map[string]*model.ScheduledTask
+
+	// directChannelMembers caches the members of the channels of the posts,
+	// or nil if they are not direct channels.
+	directChannelMembers map[string][]string
+
+	// sweepTask periodically checks the channels and the users of the queues
+	// and the deferred posts.
+	sweepTask *model.ScheduledTask
+
 	postsWaitingForOnline map[string][]*model.Post
 	deferredPosts         []*DeferredPost
+	quietHours            map[string]*QuietHours
+	heldPosts             map[string][]*model.Post
 	Queues                map[string]*Queue
+	Calendars             map[string]*Calendar
 }
 
-// ServeHTTP demonstrates a plugin that handles HTTP requests by greeting the world.
+// ServeHTTP handles the plugin REST API requests, and the activity
+// notifications of the webapp, used to deliver the posts waiting for the user
+// to be online.
 func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Request) {
+	if path := strings.Trim(r.URL.Path, "/"); strings.HasPrefix(path, "api/v1/") {
+		p.serveAPI(w, r, strings.Split(strings.TrimPrefix(path, "api/v1/"), "/"))
+		return
+	}
+
 	userID := r.Header.Get("Mattermost-User-ID")
-	if posts, ok := p.postsWaitingForOnline[userID]; ok && posts != nil {
-		for _, post := range posts {
-			p.API.CreatePost(post)
-		}
-		p.postsWaitingForOnline[userID] = nil
+	if userID != "" && p.onlineActivity.Seen(userID, time.Now(), p.getConfiguration().onlineDeliveryGracePeriod) {
+		p.stateLock.Lock()
+		p.deliverWaitingForOnlinePosts(userID)
+		p.stateLock.Unlock()
 	}
 	fmt.Fprint(w, "{}")
 }
 
 func (p *Plugin) OnActivate() error {
+	if err := p.ensureBot(); err != nil {
+		return err
+	}
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
 	err := p.RestoreWaitingForOnlinePosts()
 	if err != nil {
 		p.API.LogError("failed to restore \"waiting for online\" posts", "err", err.Error())
@@ -63,6 +132,21 @@ func (p *Plugin) OnActivate() error {
 	if err != nil {
 		p.API.LogError("failed to restore \"deferred\" posts", "err", err.Error())
 	}
+	p.quietLock.Lock()
+	err = p.RestoreQuietHours()
+	if err != nil {
+		p.API.LogError("failed to restore \"quiet hours\"", "err", err.Error())
+	}
+	err = p.RestoreHeldPosts()
+	if err != nil {
+		p.API.LogError("failed to restore \"held\" posts", "err", err.Error())
+	}
+	p.quietLock.Unlock()
+	p.releaseAllHeldPosts()
+	err = p.RestoreCalendars()
+	if err != nil {
+		p.API.LogError("failed to restore \"calendars\"", "err", err.Error())
+	}
 	err = p.RestoreQueues()
 	if err != nil {
 		p.API.LogError("failed to restore \"queues\"", "err", err.Error())
@@ -73,6 +157,14 @@ func (p *Plugin) OnActivate() error {
 	if err := p.API.RegisterCommand(createQueueCommand()); err != nil {
 		return err
 	}
+	p.sweepTask = model.CreateRecurringTask("sweep", p.sweep, sweepInterval)
+	return nil
+}
+
+func (p *Plugin) OnDeactivate() error {
+	if p.sweepTask != nil {
+		p.sweepTask.Cancel()
+	}
 	return nil
 }
 
@@ -96,34 +188,117 @@ func (p *Plugin) RestoreQueues() error {
 		p.Queues = map[string]*Queue{}
 		return err
 	}
+	changed := false
 	for _, queue := range p.Queues {
-		scheduleSpec, nErr := cronexpr.Parse(queue.SpecSource)
-		if nErr != nil {
-			p.API.LogError("failed to parse \"queue schedule\" info", "err", nErr.Error())
+		if queue.migrateMessages() {
+			changed = true
 		}
-		queue.Spec = scheduleSpec
-
-		var handleTimeout func()
-		handleTimeout = func() {
-			if len(queue.Messages) > 0 {
-				_, err := p.API.CreatePost(&model.Post{
-					UserId:    queue.UserId,
-					ChannelId: queue.ChannelId,
-					Message:   queue.Messages[0],
-				})
-				if err != nil {
-					p.API.LogError("failed to send scheduled post", "err", err.Error())
-				}
-				queue.Messages = queue.Messages[1:]
-				nErr := p.SaveQueues()
-				if nErr != nil {
-					p.API.LogError("failed to save \"queues\"", "err", err.Error())
+		scheduleSpec, nErr := parseSchedule(queue.SpecSource, queue.Anchor(), queue.Location())
+		if nErr != nil {
+			p.API.LogError("failed to parse \"queue schedule\" info", "queue", queue.Name, "err", nErr.Error())
+			queue.Spec = &invalidSchedule{Source: queue.SpecSource, Err: nErr}
+			if !queue.Paused {
+				queue.Paused = true
+				changed = true
+				message := fmt.Sprintf("The queue %s was paused because its schedule is not valid anymore: %s. Change it with `/%s set %s schedule <schedule>` and resume it with `/%s resume %s`.",
+					queue.Name, nErr.Error(), queueCommand, queue.Name, queueCommand, queue.Name)
+				for _, userID := range queue.Owners() {
+					p.notifyUser(userID, message)
 				}
 			}
-			model.CreateTask(fmt.Sprintf("check queue %s", queue.Name), handleTimeout, queue.Spec.Next(time.Now()).Sub(time.Now()))
+			continue
 		}
+		queue.Spec = scheduleSpec
+		if p.hasMissedExecution(queue, time.Now()) && p.queueCatchUpPolicy(queue) == catchUpPolicySend {
+			p.executeQueue(queue)
+			continue
+		}
+		p.scheduleQueue(queue)
+	}
+	if changed {
+		return p.SaveQueues()
+	}
+	return nil
+}
 
-		model.CreateTask(fmt.Sprintf("check queue %s", queue.Name), handleTimeout, queue.Spec.Next(time.Now()).Sub(time.Now()))
+func (p *Plugin) SaveQuietHours() error {
+	data, err := json.Marshal(p.quietHours)
+	if err != nil {
+		return err
+	}
+	p.API.KVSet("quiet-hours", data)
+	return nil
+}
+
+func (p *Plugin) RestoreQuietHours() error {
+	p.quietHours = map[string]*QuietHours{}
+	data, appErr := p.API.KVGet("quiet-hours")
+	if appErr != nil {
+		return appErr
+	}
+	if data == nil {
+		return nil
+	}
+	err := json.Unmarshal(data, &p.quietHours)
+	if err != nil {
+		p.quietHours = map[string]*QuietHours{}
+		return err
+	}
+	return nil
+}
+
+func (p *Plugin) SaveHeldPosts() error {
+	data, err := json.Marshal(p.heldPosts)
+	if err != nil {
+		return err
+	}
+	p.API.KVSet("held-posts", data)
+	return nil
+}
+
+// RestoreHeldPosts restores the posts held for users in quiet hours. They
+// must be released, or their release scheduled, after releasing the quiet
+// lock.
+func (p *Plugin) RestoreHeldPosts() error {
+	p.heldPosts = map[string][]*model.Post{}
+	p.heldReleaseTasks = map[string]*model.ScheduledTask{}
+	data, appErr := p.API.KVGet("held-posts")
+	if appErr != nil {
+		return appErr
+	}
+	if data == nil {
+		return nil
+	}
+	err := json.Unmarshal(data, &p.heldPosts)
+	if err != nil {
+		p.heldPosts = map[string][]*model.Post{}
+		return err
+	}
+	return nil
+}
+
+func (p *Plugin) SaveCalendars() error {
+	data, err := json.Marshal(p.Calendars)
+	if err != nil {
+		return err
+	}
+	p.API.KVSet("calendars", data)
+	return nil
+}
+
+func (p *Plugin) RestoreCalendars() error {
+	p.Calendars = map[string]*Calendar{}
+	data, appErr := p.API.KVGet("calendars")
+	if appErr != nil {
+		return appErr
+	}
+	if data == nil {
+		return nil
+	}
+	err := json.Unmarshal(data, &p.Calendars)
+	if err != nil {
+		p.Calendars = map[string]*Calendar{}
+		return err
 	}
 	return nil
 }
@@ -151,12 +326,12 @@ func (p *Plugin) RestoreDeferredPosts() error {
 	finalDeferredPosts := []*DeferredPost{}
 	for _, deferredPost := range p.deferredPosts {
 		if deferredPost.Time.Before(time.Now()) {
-			_, err := p.API.CreatePost(deferredPost.Post)
-			if err != nil {
-				p.API.LogError(err.Error())
-			}
-
+			p.createDeferredPost(deferredPost.Post)
 		} else {
+			if deferredPost.Post.Id == "" {
+				deferredPost.Post.Id = model.NewId()
+			}
+			p.scheduleDeferredPost(deferredPost.Post.Id, time.Until(deferredPost.Time))
 			finalDeferredPosts = append(finalDeferredPosts, deferredPost)
 		}
 	}
@@ -185,5 +360,15 @@ func (p *Plugin) RestoreWaitingForOnlinePosts() error {
 		p.deferredPosts = []*DeferredPost{}
 		return err
 	}
+	for _, posts := range p.postsWaitingForOnline {
+		for _, post := range posts {
+			if post.Id == "" {
+				post.Id = model.NewId()
+			}
+			if expiresAt := postPropTime(post, onlineExpiresAtProp); !expiresAt.IsZero() {
+				p.scheduleOnlineExpiry(post.Id, time.Until(expiresAt))
+			}
+		}
+	}
 	return nil
 }
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const queueMessageIDLength = 6
+
+// queueExecutionsToShow is the number of upcoming executions shown when
+// describing a queue.
+const queueExecutionsToShow = 5
+
+const executionTimeFormat = "Mon, 02 Jan 2006 15:04 MST"
+
+const (
+	completionActionArchive = "archive"
+	completionActionDelete  = "delete"
+	completionActionNotify  = "notify"
+)
+
+// QueueMessage is a single entry of a queue. The ID is stable for the whole
+// life of the message, so it can be safely used to address the message even
+// if other messages are added or removed concurrently.
+type QueueMessage struct {
+	ID        string            `json:"id"`
+	Message   string            `json:"message"`
+	CreatedBy string            `json:"created_by"`
+	CreatedAt int64             `json:"created_at"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	// Props are the props of the post, like the message attachments.
+	Props model.StringInterface `json:"props,omitempty"`
+	// FileIds are copies of the files to attach, copied again every time
+	// the message is sent.
+	FileIds []string `json:"file_ids,omitempty"`
+}
+
+// UnmarshalJSON supports the legacy format, where the queue messages were
+// stored as plain strings.
+func (m *QueueMessage) UnmarshalJSON(data []byte) error {
+	var message string
+	if err := json.Unmarshal(data, &message); err == nil {
+		*m = QueueMessage{Message: message}
+		return nil
+	}
+
+	type queueMessage QueueMessage
+	return json.Unmarshal(data, (*queueMessage)(m))
+}
+
+// NewMessage builds a new message for the queue with an ID not used by any
+// other message in the queue.
+func (q *Queue) NewMessage(message string, userID string) *QueueMessage {
+	return &QueueMessage{
+		ID:        q.newMessageID(),
+		Message:   message,
+		CreatedBy: userID,
+		CreatedAt: model.GetMillis(),
+	}
+}
+
+func (q *Queue) newMessageID() string {
+	for {
+		id := model.NewId()[:queueMessageIDLength]
+		if _, ok := q.messageIndexByID(id); !ok {
+			return id
+		}
+	}
+}
+
+func (q *Queue) messageIndexByID(id string) (int, bool) {
+	for idx, message := range q.Messages {
+		if message.ID == id {
+			return idx, true
+		}
+	}
+	return 0, false
+}
+
+// FindMessage returns the index of the message referenced by ref, which can
+// be the message ID or, for backwards compatibility, its position in the
+// queue.
+func (q *Queue) FindMessage(ref string) (int, bool) {
+	if idx, ok := q.messageIndexByID(ref); ok {
+		return idx, true
+	}
+	idx, err := strconv.ParseUint(ref, 10, 32)
+	if err != nil || idx >= uint64(len(q.Messages)) {
+		return 0, false
+	}
+	return int(idx), true
+}
+
+// migrateMessages fills the fields missing in messages stored with the
+// legacy format. It returns true if any message has been changed.
+func (q *Queue) migrateMessages() bool {
+	changed := false
+	for _, message := range q.Messages {
+		if message.ID == "" {
+			message.ID = q.newMessageID()
+			changed = true
+		}
+		if message.CreatedBy == "" {
+			message.CreatedBy = q.UserId
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Anchor returns the reference time of the schedules that depend on when
+// they started.
+func (q *Queue) Anchor() time.Time {
+	return millisToTime(q.CreatedAt)
+}
+
+// Owners returns the users responsible of the queue, that receive its
+// notifications. By default the owner is the creator of the queue.
+func (q *Queue) Owners() []string {
+	if len(q.OwnerIds) > 0 {
+		return q.OwnerIds
+	}
+	return []string{q.UserId}
+}
+
+func millisToTime(millis int64) time.Time {
+	return time.Unix(0, millis*int64(time.Millisecond))
+}
+
+// canManageQueues returns true if the user is allowed to manage the queues of
+// the channel. System admins can manage all the queues, and depending on the
+// configuration, the channel admins or members can manage the queues of their
+// channels.
+func (p *Plugin) canManageQueues(userID string, channelID string) bool {
+	if p.isSystemAdmin(userID) {
+		return true
+	}
+	if channelID == "" {
+		return false
+	}
+	switch p.getConfiguration().QueueManagers {
+	case queueManagersChannelAdmins:
+		return p.API.HasPermissionToChannel(userID, channelID, model.PERMISSION_MANAGE_CHANNEL_ROLES)
+	case queueManagersChannelMembers:
+		return p.API.HasPermissionToChannel(userID, channelID, model.PERMISSION_CREATE_POST)
+	}
+	return false
+}
+
+func (p *Plugin) isSystemAdmin(userID string) bool {
+	return p.API.HasPermissionTo(userID, model.PERMISSION_MANAGE_SYSTEM)
+}
+
+// manageableQueues returns the queues that the user is allowed to manage.
+func (p *Plugin) manageableQueues(userID string) []*Queue {
+	queues := []*Queue{}
+	for _, queue := range p.Queues {
+		if p.canManageQueues(userID, queue.ChannelId) {
+			queues = append(queues, queue)
+		}
+	}
+	return queues
+}
+
+// checkQueueLength returns an error if adding count messages to the queue
+// exceeds the configured maximum queue length.
+func (p *Plugin) checkQueueLength(queue *Queue, count int) error {
+	maxLength := p.getConfiguration().MaxQueueLength
+	if maxLength > 0 && len(queue.Messages)+count > maxLength {
+		return errors.Errorf("the queue %s can't have more than %d pending messages", queue.Name, maxLength)
+	}
+	return nil
+}
+
+// Location returns the timezone used to evaluate the queue schedule. Queues
+// without timezone use the server local time.
+func (q *Queue) Location() *time.Location {
+	if q.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// Schedulable returns true if the queue has a valid schedule.
+func (q *Queue) Schedulable() bool {
+	_, invalid := q.Spec.(*invalidSchedule)
+	return q.Spec != nil && !invalid
+}
+
+// Next returns the next execution time of the queue after from.
+func (q *Queue) Next(from time.Time) time.Time {
+	if q.Spec == nil {
+		return time.Time{}
+	}
+	return q.Spec.Next(from.In(q.Location()))
+}
+
+// nextQueueExecution returns the next execution time of the queue after from,
+// or the zero time if the queue has completed. Besides the schedule, it takes
+// into account the start and end of the queue, its maximum number of sends
+// and its blackout calendars. With the skip blackout policy the executions in
+// blackout dates are ignored, and with the postpone policy they are moved to
+// the same time of the first date after the blackout. If no execution is found
+// after the blackout dates, the queue is considered completed.
+func (p *Plugin) nextQueueExecution(queue *Queue, from time.Time) time.Time {
+	if queue.MaxSends > 0 && queue.Sends >= queue.MaxSends {
+		return time.Time{}
+	}
+	if startsAt := millisToTime(queue.StartsAt); queue.StartsAt != 0 && from.Before(startsAt) {
+		from = startsAt.Add(-time.Nanosecond)
+	}
+
+	calendars := p.blackoutCalendars(queue)
+	next := queue.Next(from)
+	for i := 0; !next.IsZero(); i++ {
+		end := blackoutEnd(next, calendars)
+		if end.IsZero() {
+			break
+		}
+		if i == maxBlackoutLookahead {
+			return time.Time{}
+		}
+		if queue.BlackoutPolicy == blackoutPolicyPostpone {
+			next = time.Date(end.Year(), end.Month(), end.Day(), next.Hour(), next.Minute(), next.Second(), 0, end.Location())
+		} else {
+			next = queue.Next(end.Add(-time.Nanosecond))
+		}
+	}
+
+	if queue.EndsAt != 0 && next.After(millisToTime(queue.EndsAt)) {
+		return time.Time{}
+	}
+	return next
+}
+
+// nextQueueExecutions returns the next count execution times of the queue
+// after from.
+func (p *Plugin) nextQueueExecutions(queue *Queue, from time.Time, count int) []time.Time {
+	executions := []time.Time{}
+	for len(executions) < count {
+		from = p.nextQueueExecution(queue, from)
+		if from.IsZero() {
+			break
+		}
+		executions = append(executions, from)
+	}
+	return executions
+}
+
+// describeQueueSchedule returns a readable description of the queue schedule
+// and its next executions.
+func (p *Plugin) describeQueueSchedule(queue *Queue) string {
+	lines := []string{fmt.Sprintf("* schedule: %s", queue.Spec)}
+	executions := p.nextQueueExecutions(queue, time.Now(), queueExecutionsToShow)
+	if len(executions) == 0 {
+		lines = append(lines, "* next executions: none")
+	} else {
+		lines = append(lines, "* next executions:")
+	}
+	for _, execution := range executions {
+		lines = append(lines, fmt.Sprintf("  * %s", execution.Format(executionTimeFormat)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// setQueueSchedule changes the schedule of the queue, checking that it has
+// executions in the future.
+func (p *Plugin) setQueueSchedule(queue *Queue, source string) error {
+	spec, err := parseSchedule(source, queue.Anchor(), queue.Location())
+	if err != nil {
+		return errors.Wrap(err, "unable to parse the schedule")
+	}
+	oldSource, oldSpec := queue.SpecSource, queue.Spec
+	queue.SpecSource, queue.Spec = source, spec
+	if p.nextQueueExecution(queue, time.Now()).IsZero() {
+		queue.SpecSource, queue.Spec = oldSource, oldSpec
+		return errors.New("the schedule doesn't have any execution in the future")
+	}
+	return nil
+}
+
+// setQueuePaused pauses or resumes the queue. The paused queues don't send
+// messages, and when they are resumed the next execution is scheduled again.
+func (p *Plugin) setQueuePaused(queue *Queue, paused bool) {
+	queue.Paused = paused
+	p.scheduleQueue(queue)
+	nErr := p.SaveQueues()
+	if nErr != nil {
+		p.API.LogError(nErr.Error())
+	}
+}
+
+// ReorderMessages sorts the messages of the queue in the order of the ids,
+// that must include all the messages of the queue.
+func (q *Queue) ReorderMessages(ids []string) error {
+	if len(ids) != len(q.Messages) {
+		return errors.New("the order must include all the messages of the queue")
+	}
+	messages := make([]*QueueMessage, 0, len(ids))
+	seen := map[string]bool{}
+	for _, id := range ids {
+		idx, ok := q.messageIndexByID(id)
+		if !ok || seen[id] {
+			return errors.Errorf("invalid message id %s", id)
+		}
+		seen[id] = true
+		messages = append(messages, q.Messages[idx])
+	}
+	q.Messages = messages
+	return nil
+}
+
+func indent(text string, prefix string) string {
+	return prefix + strings.Replace(text, "\n", "\n"+prefix, -1)
+}
+
+// cancelTask cancels the scheduled task without waiting for it, as it may be
+// the running task itself. The tasks check that they are still current when
+// they run.
+func cancelTask(task *model.ScheduledTask) {
+	if task != nil {
+		go task.Cancel()
+	}
+}
+
+// scheduleQueue schedules the next execution of the queue, replacing any
+// previously scheduled one. If the queue doesn't have more executions it's
+// completed.
+func (p *Plugin) scheduleQueue(queue *Queue) {
+	cancelTask(queue.task)
+	queue.task = nil
+	if queue.CompletedAt != 0 || !queue.Schedulable() || queue.Paused {
+		return
+	}
+	next := p.nextQueueExecution(queue, time.Now())
+	if next.IsZero() {
+		p.completeQueue(queue)
+		return
+	}
+	var task *model.ScheduledTask
+	task = model.CreateTask(fmt.Sprintf("check queue %s", queue.Name), func() {
+		p.stateLock.Lock()
+		defer p.stateLock.Unlock()
+		if queue.task != task {
+			return
+		}
+		queue.task = nil
+		p.executeQueue(queue)
+	}, next.Sub(time.Now()))
+	queue.task = task
+}
+
+// executeQueue sends the next message of the queue, if any, and schedules the
+// next execution.
+func (p *Plugin) executeQueue(queue *Queue) {
+	if current, ok := p.Queues[queue.Name]; !ok || current != queue {
+		return
+	}
+	queue.LastRunAt = model.GetMillis()
+	if len(queue.Messages) > 0 {
+		if err := p.checkChannelAvailable(queue.ChannelId); err != nil {
+			p.pauseQueueForChannel(queue, err)
+			return
+		}
+		authorID, authorErr := p.deliveryAuthor(queue.UserId, queue.ChannelId)
+		if authorErr != nil {
+			p.pauseQueueForAuthor(queue, authorErr)
+			return
+		}
+		_, err := p.sendQueueMessage(queue, queue.Messages[0], authorID)
+		if err != nil {
+			p.API.LogError("failed to send scheduled post", "err", err.Error())
+		} else {
+			queue.Sends++
+		}
+		queue.Messages = queue.Messages[1:]
+		p.checkQueueLowWater(queue)
+		nErr := p.SaveQueues()
+		if nErr != nil {
+			p.API.LogError("failed to save \"queues\"", "err", nErr.Error())
+		}
+	}
+	p.scheduleQueue(queue)
+}
+
+// queueCatchUpPolicy returns the catch up policy of the queue, or the default
+// one of the configuration.
+func (p *Plugin) queueCatchUpPolicy(queue *Queue) string {
+	if queue.CatchUpPolicy != "" {
+		return queue.CatchUpPolicy
+	}
+	return p.getConfiguration().DefaultCatchUpPolicy
+}
+
+// hasMissedExecution returns true if the queue should have been executed
+// between its last execution, or its creation, and now.
+func (p *Plugin) hasMissedExecution(queue *Queue, now time.Time) bool {
+	if !queue.Schedulable() || queue.Paused || queue.CompletedAt != 0 {
+		return false
+	}
+	lastRun := queue.LastRunAt
+	if lastRun == 0 {
+		lastRun = queue.CreatedAt
+	}
+	if lastRun == 0 {
+		return false
+	}
+	next := p.nextQueueExecution(queue, millisToTime(lastRun))
+	return !next.IsZero() && next.Before(now)
+}
+
+// completeQueue marks the queue as completed and runs its on completion
+// actions.
+func (p *Plugin) completeQueue(queue *Queue) {
+	queue.CompletedAt = model.GetMillis()
+	for _, action := range queue.OnCompletion {
+		switch action {
+		case completionActionArchive:
+			queue.Archived = true
+		case completionActionDelete:
+			if current, ok := p.Queues[queue.Name]; ok && current == queue {
+				delete(p.Queues, queue.Name)
+			}
+		case completionActionNotify:
+			for _, userID := range queue.Owners() {
+				p.notifyUser(userID, fmt.Sprintf("The queue **%s** has completed after sending %d messages, with %d messages pending.", queue.Name, queue.Sends, len(queue.Messages)))
+			}
+		}
+	}
+	nErr := p.SaveQueues()
+	if nErr != nil {
+		p.API.LogError("failed to save \"queues\"", "err", nErr.Error())
+	}
+}
+
+// describeQueue returns a readable description of the queue settings and
+// status.
+func (p *Plugin) describeQueue(queue *Queue) string {
+	nextMessage := "no messages in the queue"
+	if len(queue.Messages) > 0 {
+		nextMessage = queue.Messages[0].Message
+	}
+	calendars := "none"
+	if len(queue.Calendars) > 0 {
+		blackoutPolicy := queue.BlackoutPolicy
+		if blackoutPolicy == "" {
+			blackoutPolicy = blackoutPolicySkip
+		}
+		calendars = fmt.Sprintf("%s (%s)", strings.Join(queue.Calendars, ", "), blackoutPolicy)
+	}
+	lines := []string{
+		fmt.Sprintf(" * %s", queue.Name),
+		fmt.Sprintf("  * channel id: %s", queue.ChannelId),
+		fmt.Sprintf("  * schedule spec: %s", queue.SpecSource),
+		fmt.Sprintf("  * timezone: %s", queue.Location()),
+		fmt.Sprintf("  * blackout calendars: %s", calendars),
+	}
+	if lifecycle := p.describeQueueLifecycle(queue); lifecycle != "" {
+		lines = append(lines, fmt.Sprintf("  * lifecycle: %s", lifecycle))
+	}
+	lines = append(lines,
+		indent(p.describeQueueSchedule(queue), "  "),
+		fmt.Sprintf("  * next message: %s", nextMessage),
+	)
+	return strings.Join(lines, "\n")
+}
+
+// describeQueueLifecycle returns a readable description of the lifecycle
+// settings of the queue, or an empty string if it doesn't have any.
+func (p *Plugin) describeQueueLifecycle(queue *Queue) string {
+	parts := []string{}
+	if queue.StartsAt != 0 {
+		parts = append(parts, "starts at "+millisToTime(queue.StartsAt).In(queue.Location()).Format(executionTimeFormat))
+	}
+	if queue.EndsAt != 0 {
+		parts = append(parts, "ends at "+millisToTime(queue.EndsAt).In(queue.Location()).Format(executionTimeFormat))
+	}
+	if queue.MaxSends > 0 {
+		parts = append(parts, fmt.Sprintf("%d of %d messages sent", queue.Sends, queue.MaxSends))
+	}
+	if len(queue.OnCompletion) > 0 {
+		parts = append(parts, "on completion: "+strings.Join(queue.OnCompletion, ", "))
+	}
+	if queue.LowWater > 0 {
+		parts = append(parts, fmt.Sprintf("low water alert below %d %s", queue.LowWater, queue.LowWaterUnit))
+	}
+	if queue.Paused {
+		parts = append(parts, "paused")
+	}
+	if queue.CatchUpPolicy != "" {
+		parts = append(parts, "catch up: "+queue.CatchUpPolicy)
+	}
+	if queue.CompletedAt != 0 {
+		parts = append(parts, "completed at "+millisToTime(queue.CompletedAt).In(queue.Location()).Format(executionTimeFormat))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueLegacyMessages(t *testing.T) {
+	queues := map[string]*Queue{}
+	err := json.Unmarshal([]byte(`{"tips": {"name": "tips", "user_id": "user1", "messages": ["first", "second"]}}`), &queues)
+	require.NoError(t, err)
+
+	queue := queues["tips"]
+	require.Len(t, queue.Messages, 2)
+	assert.Equal(t, "first", queue.Messages[0].Message)
+	assert.Equal(t, "second", queue.Messages[1].Message)
+
+	assert.True(t, queue.migrateMessages())
+	assert.False(t, queue.migrateMessages())
+	assert.Equal(t, "user1", queue.Messages[0].CreatedBy)
+	assert.Len(t, queue.Messages[0].ID, queueMessageIDLength)
+	assert.NotEqual(t, queue.Messages[0].ID, queue.Messages[1].ID)
+}
+
+func TestQueueFindMessage(t *testing.T) {
+	queue := &Queue{Messages: []*QueueMessage{{ID: "abc123"}, {ID: "def456"}}}
+
+	idx, ok := queue.FindMessage("def456")
+	assert.True(t, ok)
+	assert.Equal(t, 1, idx)
+
+	idx, ok = queue.FindMessage("0")
+	assert.True(t, ok)
+	assert.Equal(t, 0, idx)
+
+	_, ok = queue.FindMessage("2")
+	assert.False(t, ok)
+
+	_, ok = queue.FindMessage("unknown")
+	assert.False(t, ok)
+}
+
+func TestQueueReorderMessages(t *testing.T) {
+	queue := &Queue{Messages: []*QueueMessage{{ID: "a"}, {ID: "b"}, {ID: "c"}}}
+
+	require.NoError(t, queue.ReorderMessages([]string{"c", "a", "b"}))
+	assert.Equal(t, []*QueueMessage{{ID: "c"}, {ID: "a"}, {ID: "b"}}, queue.Messages)
+
+	assert.Error(t, queue.ReorderMessages([]string{"c", "a"}))
+	assert.Error(t, queue.ReorderMessages([]string{"c", "a", "a"}))
+	assert.Error(t, queue.ReorderMessages([]string{"c", "a", "d"}))
+	assert.Equal(t, []*QueueMessage{{ID: "c"}, {ID: "a"}, {ID: "b"}}, queue.Messages)
+}
+
+func TestNextQueueExecutionLifecycle(t *testing.T) {
+	p := &Plugin{}
+	queue := &Queue{Spec: mustParseSchedule(t, "0 10 * * *"), Timezone: "UTC"}
+	from := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	queue.StartsAt = model.GetMillisForTime(time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC), p.nextQueueExecution(queue, from))
+
+	queue.StartsAt = 0
+	queue.EndsAt = model.GetMillisForTime(time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC), p.nextQueueExecution(queue, from.Add(-24*time.Hour)))
+	assert.True(t, p.nextQueueExecution(queue, from).IsZero())
+
+	queue.EndsAt = 0
+	queue.MaxSends = 2
+	queue.Sends = 2
+	assert.True(t, p.nextQueueExecution(queue, from).IsZero())
+}
+
+func TestQueueCatchUp(t *testing.T) {
+	p := &Plugin{}
+	queue := &Queue{Spec: mustParseSchedule(t, "0 10 * * *"), Timezone: "UTC"}
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	assert.False(t, p.hasMissedExecution(queue, now))
+	queue.LastRunAt = model.GetMillisForTime(time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC))
+	assert.False(t, p.hasMissedExecution(queue, now))
+	queue.LastRunAt = model.GetMillisForTime(time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC))
+	assert.True(t, p.hasMissedExecution(queue, now))
+	queue.Paused = true
+	assert.False(t, p.hasMissedExecution(queue, now))
+
+	assert.Equal(t, catchUpPolicySkip, p.queueCatchUpPolicy(queue))
+	queue.CatchUpPolicy = catchUpPolicySend
+	assert.Equal(t, catchUpPolicySend, p.queueCatchUpPolicy(queue))
+}
+
+func TestQueueLowWater(t *testing.T) {
+	threshold, unit, err := parseLowWater("5")
+	require.NoError(t, err)
+	assert.Equal(t, 5, threshold)
+	assert.Equal(t, lowWaterUnitMessages, unit)
+
+	threshold, unit, err = parseLowWater("3 days")
+	require.NoError(t, err)
+	assert.Equal(t, 3, threshold)
+	assert.Equal(t, lowWaterUnitDays, unit)
+
+	_, _, err = parseLowWater("soon")
+	assert.Error(t, err)
+
+	p := &Plugin{}
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	queue := &Queue{
+		Spec:         mustParseSchedule(t, "0 10 * * *"),
+		Timezone:     "UTC",
+		Messages:     []*QueueMessage{{ID: "a"}, {ID: "b"}, {ID: "c"}},
+		LowWater:     3,
+		LowWaterUnit: lowWaterUnitDays,
+	}
+	// The last message is sent on the 19th at 10:00
+	assert.True(t, p.isQueueLowWater(queue, now))
+	queue.LowWater = 2
+	assert.False(t, p.isQueueLowWater(queue, now))
+
+	queue.LowWaterUnit = lowWaterUnitMessages
+	assert.False(t, p.isQueueLowWater(queue, now))
+	queue.LowWater = 4
+	assert.True(t, p.isQueueLowWater(queue, now))
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+	"github.com/pkg/errors"
+)
+
+// quietHoursTimeFormat is the format of the start and the end of the quiet
+// hours.
+const quietHoursTimeFormat = "15:04"
+
+// QuietHours are the times when the direct messages sent to a user are held
+// by the plugin, and delivered when they end.
+type QuietHours struct {
+	// Start and End are the daily quiet hours, like 22:00 and 08:00, in the
+	// timezone of the user.
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+	// Hold holds all the direct messages until it's turned off.
+	Hold bool `json:"hold,omitempty"`
+}
+
+// parseQuietHours parses quiet hours like 22:00-08:00.
+func parseQuietHours(value string) (*QuietHours, error) {
+	parts := strings.Split(value, "-")
+	if len(parts) != 2 {
+		return nil, errors.Errorf("Invalid quiet hours %s, use a range like 22:00-08:00", value)
+	}
+	quietHours := &QuietHours{Start: strings.TrimSpace(parts[0]), End: strings.TrimSpace(parts[1])}
+	for _, clock := range []string{quietHoursTimeFormat, "15"} {
+		start, startErr := time.Parse(clock, quietHours.Start)
+		end, endErr := time.Parse(clock, quietHours.End)
+		if startErr == nil && endErr == nil {
+			quietHours.Start = start.Format(quietHoursTimeFormat)
+			quietHours.End = end.Format(quietHoursTimeFormat)
+			if quietHours.Start == quietHours.End {
+				return nil, errors.New("The quiet hours can't start and end at the same time")
+			}
+			return quietHours, nil
+		}
+	}
+	return nil, errors.Errorf("Invalid quiet hours %s, use a range like 22:00-08:00", value)
+}
+
+// ActiveUntil returns when the quiet hours that include now end, or the zero
+// time if now is not in the quiet hours. When the messages are held until
+// further notice, it returns the maximum time.
+func (q *QuietHours) ActiveUntil(now time.Time) time.Time {
+	if q.Hold {
+		return time.Unix(1<<62, 0)
+	}
+	start, startErr := time.Parse(quietHoursTimeFormat, q.Start)
+	end, endErr := time.Parse(quietHoursTimeFormat, q.End)
+	if startErr != nil || endErr != nil {
+		return time.Time{}
+	}
+	at := func(day time.Time, clock time.Time) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	}
+	// The quiet hours that include now started today or, if they span
+	// midnight, yesterday.
+	for _, day := range []time.Time{now, now.AddDate(0, 0, -1)} {
+		startsAt := at(day, start)
+		endsAt := at(day, end)
+		if !endsAt.After(startsAt) {
+			endsAt = at(day.AddDate(0, 0, 1), end)
+		}
+		if !now.Before(startsAt) && now.Before(endsAt) {
+			return endsAt
+		}
+	}
+	return time.Time{}
+}
+
+// String describes the quiet hours.
+func (q *QuietHours) String() string {
+	switch {
+	case q.Hold && q.Start != "":
+		return fmt.Sprintf("from %s to %s, and your direct messages are held until you stop holding them", q.Start, q.End)
+	case q.Hold:
+		return "off, but your direct messages are held until you stop holding them"
+	}
+	return fmt.Sprintf("from %s to %s", q.Start, q.End)
+}
+
+// quietUntil returns when the quiet hours of the user end, or the zero time
+// if the user is not in quiet hours now. It must be called holding the quiet
+// lock.
+func (p *Plugin) quietUntil(userID string) time.Time {
+	quietHours, ok := p.quietHours[userID]
+	if !ok {
+		return time.Time{}
+	}
+	now := time.Now()
+	if user, appErr := p.API.GetUser(userID); appErr == nil {
+		if loc, err := time.LoadLocation(user.GetPreferredTimezone()); err == nil {
+			now = now.In(loc)
+		}
+	}
+	return quietHours.ActiveUntil(now)
+}
+
+// maxCachedDirectChannels is how many channels quietHoursRecipient remembers
+// before starting over.
+const maxCachedDirectChannels = 10000
+
+// quietHoursRecipient returns the other user of the direct channel of the
+// post if it has quiet hours, or an empty string. The members of the direct
+// channels are taken from their names, like <user id>__<user id>, and cached,
+// so each channel is only fetched once.
+func (p *Plugin) quietHoursRecipient(post *model.Post) string {
+	p.quietLock.Lock()
+	if len(p.quietHours) == 0 {
+		p.quietLock.Unlock()
+		return ""
+	}
+	members, cached := p.directChannelMembers[post.ChannelId]
+	p.quietLock.Unlock()
+
+	if !cached {
+		channel, appErr := p.API.GetChannel(post.ChannelId)
+		if appErr != nil {
+			return ""
+		}
+		if channel.Type == model.CHANNEL_DIRECT {
+			members = strings.Split(channel.Name, "__")
+		}
+		p.quietLock.Lock()
+		if p.directChannelMembers == nil || len(p.directChannelMembers) >= maxCachedDirectChannels {
+			p.directChannelMembers = map[string][]string{}
+		}
+		p.directChannelMembers[post.ChannelId] = members
+		p.quietLock.Unlock()
+	}
+
+	if len(members) != 2 || members[0] == members[1] {
+		return ""
+	}
+	recipientID := members[0]
+	if recipientID == post.UserId {
+		recipientID = members[1]
+	} else if members[1] != post.UserId {
+		return ""
+	}
+	p.quietLock.Lock()
+	defer p.quietLock.Unlock()
+	if _, ok := p.quietHours[recipientID]; !ok {
+		return ""
+	}
+	return recipientID
+}
+
+// MessageWillBePosted holds the direct messages sent to users in quiet hours,
+// unless they include the urgent keyword, and tells the sender when they will
+// be delivered. It runs concurrently for every post, including the ones
+// created by the plugin, so it only takes the quiet lock, and never while
+// creating posts.
+func (p *Plugin) MessageWillBePosted(c *plugin.Context, post *model.Post) (*model.Post, string) {
+	config := p.getConfiguration()
+	if !config.EnableQuietHours || post.IsSystemMessage() || post.UserId == p.botUserID {
+		return post, ""
+	}
+	if config.UrgentKeyword != "" && strings.Contains(strings.ToLower(post.Message), strings.ToLower(config.UrgentKeyword)) {
+		return post, ""
+	}
+	recipientID := p.quietHoursRecipient(post)
+	if recipientID == "" {
+		return post, ""
+	}
+
+	p.quietLock.Lock()
+	until := p.quietUntil(recipientID)
+	if until.IsZero() {
+		p.quietLock.Unlock()
+		return post, ""
+	}
+	held := post.Clone()
+	held.Id = model.NewId()
+	held.CreateAt = 0
+	held.UpdateAt = 0
+	held.PendingPostId = ""
+	held.AddProp(onlineComposedAtProp, model.GetMillis())
+	p.heldPosts[recipientID] = append(p.heldPosts[recipientID], held)
+	p.SaveHeldPosts()
+	hold := p.quietHours[recipientID].Hold
+	if _, scheduled := p.heldReleaseTasks[recipientID]; !hold && !scheduled {
+		p.scheduleHeldPostsRelease(recipientID, time.Until(until))
+	}
+	p.quietLock.Unlock()
+
+	notice := fmt.Sprintf("%s is in quiet hours, your message will be delivered when they end", p.onlineRecipientName(recipientID))
+	if hold {
+		notice = fmt.Sprintf("%s is holding their direct messages, your message will be delivered when they stop", p.onlineRecipientName(recipientID))
+	} else {
+		notice += fmt.Sprintf(", at %s their time", until.Format(quietHoursTimeFormat))
+	}
+	if config.UrgentKeyword != "" {
+		notice += fmt.Sprintf(". If it's urgent, send it again including %s", config.UrgentKeyword)
+	}
+	_ = p.API.SendEphemeralPost(post.UserId, &model.Post{
+		ChannelId: post.ChannelId,
+		RootId:    post.RootId,
+		Message:   notice + ".",
+	})
+	return nil, "the recipient is in quiet hours, the message will be delivered later"
+}
+
+// scheduleHeldPostsRelease releases the posts held for the user after the
+// duration. There is only one release pending for each user, so it must be
+// called holding the quiet lock, after cancelling the pending one.
+func (p *Plugin) scheduleHeldPostsRelease(userID string, duration time.Duration) {
+	p.heldReleaseTasks[userID] = model.CreateTask("release held posts", func() {
+		p.releaseHeldPosts(userID)
+	}, duration)
+}
+
+// releaseHeldPosts sends the posts held for the user if it's not in quiet
+// hours anymore, or schedules their release when the quiet hours end,
+// replacing the release pending before.
+func (p *Plugin) releaseHeldPosts(userID string) {
+	p.quietLock.Lock()
+	if task, ok := p.heldReleaseTasks[userID]; ok {
+		cancelTask(task)
+		delete(p.heldReleaseTasks, userID)
+	}
+	if len(p.heldPosts[userID]) == 0 {
+		p.quietLock.Unlock()
+		return
+	}
+	if until := p.quietUntil(userID); !until.IsZero() {
+		if !p.quietHours[userID].Hold {
+			p.scheduleHeldPostsRelease(userID, time.Until(until))
+		}
+		p.quietLock.Unlock()
+		return
+	}
+	posts := orderWaitingForOnlinePosts(p.heldPosts[userID])
+	delete(p.heldPosts, userID)
+	p.SaveHeldPosts()
+	p.quietLock.Unlock()
+
+	showComposeTime := p.getConfiguration().ShowOnlineComposeTime
+	for _, post := range posts {
+		if showComposeTime {
+			post = p.withComposeTime(post, userID)
+		}
+		p.createHeldPost(post)
+	}
+}
+
+// createHeldPost sends the held post as it was written, if the channel is
+// available and its author can still post in it, like createDeferredPost.
+// The post id and the compose time are only used by the plugin, so they are
+// cleared.
+func (p *Plugin) createHeldPost(post *model.Post) {
+	err := p.checkChannelAvailable(post.ChannelId)
+	authorID := ""
+	if err == nil {
+		authorID, err = p.deliveryAuthor(post.UserId, post.ChannelId)
+	}
+	if err != nil {
+		p.notifyUser(post.UserId, fmt.Sprintf("Your message held during quiet hours was cancelled because %s:\n%s", err.Error(), previewMessage(post.Message)))
+		return
+	}
+	created := post.Clone()
+	created.Id = ""
+	created.DelProp(onlineComposedAtProp)
+	if authorID != post.UserId {
+		created.UserId = authorID
+		created.Message = strings.TrimSpace(created.Message + "\n\n" + p.onBehalfOf(post.UserId))
+	}
+	if _, appErr := p.API.CreatePost(created); appErr != nil {
+		p.API.LogError("failed to send the held post", "err", appErr.Error())
+	}
+}
+
+// releaseAllHeldPosts releases the posts held for the users not in quiet
+// hours anymore, and schedules the release of the others.
+func (p *Plugin) releaseAllHeldPosts() {
+	for userID := range p.heldPostsByUser() {
+		p.releaseHeldPosts(userID)
+	}
+}
+
+// heldPostsByUser returns a copy of the posts held for each user.
+func (p *Plugin) heldPostsByUser() map[string][]*model.Post {
+	p.quietLock.Lock()
+	defer p.quietLock.Unlock()
+	heldPosts := make(map[string][]*model.Post, len(p.heldPosts))
+	for userID, posts := range p.heldPosts {
+		heldPosts[userID] = append([]*model.Post{}, posts...)
+	}
+	return heldPosts
+}
+
+// removeHeldPost removes the held post with the given id, and returns it, or
+// nil if it's not held.
+func (p *Plugin) removeHeldPost(id string) *model.Post {
+	p.quietLock.Lock()
+	defer p.quietLock.Unlock()
+	for userID, posts := range p.heldPosts {
+		for idx, post := range posts {
+			if post.Id == id {
+				p.heldPosts[userID] = append(posts[:idx:idx], posts[idx+1:]...)
+				p.SaveHeldPosts()
+				return post
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Plugin) executeQuietHoursCommand(c *plugin.Context, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	split := parseCommand(args.Command).Values()
+	if !p.getConfiguration().EnableQuietHours {
+		return &model.CommandResponse{
+			ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+			ChannelId:    args.ChannelId,
+			Text:         "The quiet hours are disabled",
+		}, nil
+	}
+
+	p.quietLock.Lock()
+	quietHours := &QuietHours{}
+	if current, ok := p.quietHours[args.UserId]; ok {
+		clone := *current
+		quietHours = &clone
+	}
+	p.quietLock.Unlock()
+	if len(split) >= 3 {
+		value := split[2]
+		switch {
+		case split[1] == "hold" && (value == "on" || value == "off"):
+			quietHours.Hold = value == "on"
+		case split[1] == "hold":
+			return &model.CommandResponse{
+				ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+				ChannelId:    args.ChannelId,
+				Text:         "Use /defer-post hold on or /defer-post hold off",
+			}, nil
+		case value == "off":
+			quietHours.Start, quietHours.End = "", ""
+		default:
+			parsed, err := parseQuietHours(value)
+			if err != nil {
+				return &model.CommandResponse{
+					ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+					ChannelId:    args.ChannelId,
+					Text:         err.Error(),
+				}, nil
+			}
+			quietHours.Start, quietHours.End = parsed.Start, parsed.End
+		}
+		p.quietLock.Lock()
+		if quietHours.Hold || quietHours.Start != "" {
+			p.quietHours[args.UserId] = quietHours
+		} else {
+			delete(p.quietHours, args.UserId)
+		}
+		p.SaveQuietHours()
+		p.quietLock.Unlock()
+		p.releaseHeldPosts(args.UserId)
+	}
+
+	text := "You don't have quiet hours"
+	if quietHours.Hold || quietHours.Start != "" {
+		text = fmt.Sprintf("Your quiet hours are %s", quietHours)
+	}
+	return &model.CommandResponse{
+		ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL,
+		ChannelId:    args.ChannelId,
+		Text:         text,
+	}, nil
+}
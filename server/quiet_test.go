@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	quietHours, err := parseQuietHours("22:00-08:30")
+	require.NoError(t, err)
+	assert.Equal(t, &QuietHours{Start: "22:00", End: "08:30"}, quietHours)
+
+	quietHours, err = parseQuietHours("13-14")
+	require.NoError(t, err)
+	assert.Equal(t, &QuietHours{Start: "13:00", End: "14:00"}, quietHours)
+
+	for _, value := range []string{"22:00", "22:00-25:00", "night", "09:00-09:00"} {
+		_, err = parseQuietHours(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestQuietHoursActiveUntil(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Madrid")
+	require.NoError(t, err)
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, loc)
+	}
+
+	overnight := &QuietHours{Start: "22:00", End: "08:00"}
+	assert.Equal(t, at(17, 8, 0), overnight.ActiveUntil(at(16, 23, 0)))
+	assert.Equal(t, at(17, 8, 0), overnight.ActiveUntil(at(17, 7, 59)))
+	assert.True(t, overnight.ActiveUntil(at(17, 8, 0)).IsZero())
+	assert.True(t, overnight.ActiveUntil(at(17, 12, 0)).IsZero())
+
+	lunch := &QuietHours{Start: "13:00", End: "14:00"}
+	assert.Equal(t, at(16, 14, 0), lunch.ActiveUntil(at(16, 13, 30)))
+	assert.True(t, lunch.ActiveUntil(at(16, 12, 59)).IsZero())
+
+	hold := &QuietHours{Hold: true}
+	assert.True(t, hold.ActiveUntil(at(16, 12, 0)).After(at(16, 12, 0).AddDate(100, 0, 0)))
+}
+
+func TestCreateHeldPost(t *testing.T) {
+	newHeldPost := func(userID string) *model.Post {
+		post := &model.Post{Id: model.NewId(), UserId: userID, ChannelId: "dm", Message: "Good night"}
+		post.AddProp(onlineComposedAtProp, model.GetMillis())
+		return post
+	}
+	newPlugin := func(policy string) (*Plugin, *plugintest.API) {
+		api := &plugintest.API{}
+		api.On("GetChannel", "dm").Return(&model.Channel{Id: "dm", Type: model.CHANNEL_DIRECT}, nil)
+		api.On("GetUser", "alice").Return(&model.User{Id: "alice", Username: "alice"}, nil)
+		api.On("GetUser", "bob").Return(&model.User{Id: "bob", Username: "bob", DeleteAt: 1}, nil)
+		api.On("HasPermissionToChannel", "alice", "dm", model.PERMISSION_CREATE_POST).Return(true)
+		api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("GetDirectChannel", "bob", "bot").Return(&model.Channel{Id: "bot-dm"}, nil)
+		api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+		p := &Plugin{botUserID: "bot"}
+		p.SetAPI(api)
+		p.setConfiguration(&configuration{InvalidAuthorPolicy: policy})
+		return p, api
+	}
+
+	p, api := newPlugin(invalidAuthorPolicyCancel)
+	p.createHeldPost(newHeldPost("alice"))
+	api.AssertCalled(t, "CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.Id == "" && post.UserId == "alice" && post.Message == "Good night" && post.GetProp(onlineComposedAtProp) == nil
+	}))
+
+	p, api = newPlugin(invalidAuthorPolicyCancel)
+	p.createHeldPost(newHeldPost("bob"))
+	api.AssertCalled(t, "CreatePost", &model.Post{
+		UserId:    "bot",
+		ChannelId: "bot-dm",
+		Message:   "Your message held during quiet hours was cancelled because @bob is deactivated:\nGood night",
+	})
+	api.AssertNotCalled(t, "CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.ChannelId == "dm"
+	}))
+
+	p, api = newPlugin(invalidAuthorPolicyReassign)
+	p.createHeldPost(newHeldPost("bob"))
+	api.AssertCalled(t, "CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.UserId == "bot" && post.ChannelId == "dm" && post.Message == "Good night\n\n_Sent on behalf of @bob_"
+	}))
+}
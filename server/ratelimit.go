@@ -0,0 +1,36 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter limits the number of events of each key in a sliding window.
+type rateLimiter struct {
+	mutex  sync.Mutex
+	events map[string][]time.Time
+}
+
+// Allow records an event for the key and returns true if there are no more
+// than limit events in the window before now. The rejected events are not
+// recorded.
+func (l *rateLimiter) Allow(key string, limit int, window time.Duration, now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.events == nil {
+		l.events = map[string][]time.Time{}
+	}
+	recent := []time.Time{}
+	for _, event := range l.events[key] {
+		if now.Sub(event) < window {
+			recent = append(recent, event)
+		}
+	}
+	if len(recent) >= limit {
+		l.events[key] = recent
+		return false
+	}
+	l.events[key] = append(recent, now)
+	return true
+}
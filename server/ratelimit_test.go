@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := &rateLimiter{}
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	assert.True(t, limiter.Allow("user1", 2, time.Hour, now))
+	assert.True(t, limiter.Allow("user1", 2, time.Hour, now.Add(time.Minute)))
+	assert.False(t, limiter.Allow("user1", 2, time.Hour, now.Add(2*time.Minute)))
+	assert.True(t, limiter.Allow("user2", 2, time.Hour, now.Add(2*time.Minute)))
+	assert.True(t, limiter.Allow("user1", 2, time.Hour, now.Add(time.Hour)))
+	assert.False(t, limiter.Allow("user1", 2, time.Hour, now.Add(time.Hour+time.Second)))
+}
@@ -0,0 +1,618 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorhill/cronexpr"
+	"github.com/pkg/errors"
+)
+
+// maxScheduleLookahead limits the number of candidates evaluated when looking
+// for the next execution of a filtered schedule.
+const maxScheduleLookahead = 1000
+
+const minScheduleInterval = time.Minute
+
+// Schedule is the recurring schedule of a queue.
+type Schedule interface {
+	// Next returns the first execution strictly after from, evaluated in the
+	// location of from. It returns the zero time if there are no more
+	// executions.
+	Next(from time.Time) time.Time
+	// String returns a human readable description of the schedule.
+	String() string
+}
+
+var scheduleDateFormats = []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"}
+
+// parseSchedule parses a schedule made of one or more expressions separated
+// by semicolons, where the schedule executes on the executions of any of the
+// expressions. Each expression can be in any of the supported formats: cron
+// expressions, cron descriptors (like @daily), fixed intervals (@every 36h)
+// and English sentences (like "every weekday at 10:00").
+//
+// The schedule can be limited with "from <date>" and "until <date>" parts,
+// using dates in the loc timezone. The anchor is the reference time for the
+// expressions that depend on when they started, like the intervals or "every
+// other monday", and it's replaced by the "from" date when present.
+func parseSchedule(source string, anchor time.Time, loc *time.Location) (Schedule, error) {
+	schedule := &unionSchedule{}
+	expressions := []string{}
+	for _, part := range strings.Split(source, ";") {
+		part = strings.TrimSpace(part)
+		lower := strings.ToLower(part)
+		switch {
+		case part == "":
+		case strings.HasPrefix(lower, "from "):
+			start, _, err := parseScheduleDate(part[len("from "):], loc)
+			if err != nil {
+				return nil, err
+			}
+			schedule.Start = start
+		case strings.HasPrefix(lower, "until "):
+			end, dateOnly, err := parseScheduleDate(part[len("until "):], loc)
+			if err != nil {
+				return nil, err
+			}
+			if dateOnly {
+				// Include the whole day
+				end = end.AddDate(0, 0, 1).Add(-time.Nanosecond)
+			}
+			schedule.End = end
+		default:
+			expressions = append(expressions, part)
+		}
+	}
+
+	if len(expressions) == 0 {
+		return nil, errors.New("the schedule doesn't have any expression")
+	}
+	if !schedule.Start.IsZero() && !schedule.End.IsZero() && !schedule.Start.Before(schedule.End) {
+		return nil, errors.New("the schedule ends before it starts")
+	}
+	if !schedule.Start.IsZero() {
+		anchor = schedule.Start
+	}
+
+	for _, expression := range expressions {
+		parsed, err := parseScheduleExpression(expression, anchor)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid expression %q", expression)
+		}
+		schedule.Schedules = append(schedule.Schedules, parsed)
+	}
+
+	if len(schedule.Schedules) == 1 && schedule.Start.IsZero() && schedule.End.IsZero() {
+		return schedule.Schedules[0], nil
+	}
+	return schedule, nil
+}
+
+func parseScheduleDate(text string, loc *time.Location) (time.Time, bool, error) {
+	text = strings.TrimSpace(text)
+	for _, format := range scheduleDateFormats {
+		if date, err := time.ParseInLocation(format, text, loc); err == nil {
+			return date, format == calendarDateFormat, nil
+		}
+	}
+	return time.Time{}, false, errors.Errorf("invalid date %q, use a date like 2006-01-02 or 2006-01-02 15:04", text)
+}
+
+// parseScheduleExpression parses a single schedule expression.
+func parseScheduleExpression(source string, anchor time.Time) (Schedule, error) {
+	source = strings.TrimSpace(source)
+	lower := strings.ToLower(source)
+
+	if strings.HasPrefix(lower, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(source[len("@every "):]))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid interval")
+		}
+		if interval < minScheduleInterval {
+			return nil, errors.Errorf("the interval must be at least %s", minScheduleInterval)
+		}
+		return &intervalSchedule{Interval: interval, Anchor: anchor}, nil
+	}
+
+	if strings.HasPrefix(lower, "every ") {
+		return parseEnglishSchedule(lower, anchor)
+	}
+
+	return newCronSchedule(source)
+}
+
+// invalidSchedule is the schedule of a stored queue whose schedule can't be
+// parsed anymore. It doesn't have executions, so the queue isn't scheduled
+// until its schedule is changed.
+type invalidSchedule struct {
+	Source string
+	Err    error
+}
+
+func (s *invalidSchedule) Next(from time.Time) time.Time {
+	return time.Time{}
+}
+
+func (s *invalidSchedule) String() string {
+	return fmt.Sprintf("invalid schedule %s (%s)", s.Source, s.Err.Error())
+}
+
+// unionSchedule executes on the executions of any of its schedules, between
+// the optional start and end times.
+type unionSchedule struct {
+	Schedules []Schedule
+	Start     time.Time
+	End       time.Time
+}
+
+func (s *unionSchedule) Next(from time.Time) time.Time {
+	if !s.Start.IsZero() && from.Before(s.Start) {
+		// Include an execution at the start time
+		from = s.Start.Add(-time.Nanosecond).In(from.Location())
+	}
+	var next time.Time
+	for _, schedule := range s.Schedules {
+		candidate := schedule.Next(from)
+		if !candidate.IsZero() && (next.IsZero() || candidate.Before(next)) {
+			next = candidate
+		}
+	}
+	if !s.End.IsZero() && next.After(s.End) {
+		return time.Time{}
+	}
+	return next
+}
+
+func (s *unionSchedule) String() string {
+	descriptions := []string{}
+	for idx, schedule := range s.Schedules {
+		description := schedule.String()
+		if idx > 0 {
+			description = strings.ToLower(description[:1]) + description[1:]
+		}
+		descriptions = append(descriptions, description)
+	}
+	text := strings.Join(descriptions, "; and ")
+	if !s.Start.IsZero() {
+		text += ", from " + s.Start.Format("2006-01-02 15:04")
+	}
+	if !s.End.IsZero() {
+		text += ", until " + s.End.Format("2006-01-02 15:04")
+	}
+	return text
+}
+
+// cronSchedule is a schedule defined by a cron expression.
+type cronSchedule struct {
+	Source string
+	Expr   *cronexpr.Expression
+}
+
+func newCronSchedule(source string) (*cronSchedule, error) {
+	expr, err := cronexpr.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	return &cronSchedule{Source: source, Expr: expr}, nil
+}
+
+func (s *cronSchedule) Next(from time.Time) time.Time {
+	return nextInLocation(s.Expr, from, from.Location())
+}
+
+func (s *cronSchedule) String() string {
+	return describeCron(s.Source)
+}
+
+// nextInLocation evaluates the cron expression against the wall clock of loc.
+// The expression is evaluated over a timezone without DST transitions, so
+// times skipped when the clock moves forward are moved to the first valid time
+// after them, and times repeated when the clock moves backward only trigger
+// once.
+func nextInLocation(spec *cronexpr.Expression, from time.Time, loc *time.Location) time.Time {
+	from = from.In(loc)
+	wallClock := time.Date(from.Year(), from.Month(), from.Day(), from.Hour(), from.Minute(), from.Second(), from.Nanosecond(), time.UTC)
+	for {
+		wallClock = spec.Next(wallClock)
+		if wallClock.IsZero() {
+			return wallClock
+		}
+		next := time.Date(wallClock.Year(), wallClock.Month(), wallClock.Day(), wallClock.Hour(), wallClock.Minute(), wallClock.Second(), 0, loc)
+		if next.After(from) {
+			return next
+		}
+	}
+}
+
+// intervalSchedule is a schedule with a fixed interval between executions,
+// anchored to a start time.
+type intervalSchedule struct {
+	Interval time.Duration
+	Anchor   time.Time
+}
+
+func (s *intervalSchedule) Next(from time.Time) time.Time {
+	if from.Before(s.Anchor) {
+		return s.Anchor.In(from.Location())
+	}
+	periods := from.Sub(s.Anchor)/s.Interval + 1
+	return s.Anchor.Add(periods * s.Interval).In(from.Location())
+}
+
+func (s *intervalSchedule) String() string {
+	return "Every " + formatInterval(s.Interval)
+}
+
+func formatInterval(interval time.Duration) string {
+	switch {
+	case interval%(24*time.Hour) == 0:
+		return pluralize(int(interval/(24*time.Hour)), "day")
+	case interval%time.Hour == 0:
+		return pluralize(int(interval/time.Hour), "hour")
+	case interval%time.Minute == 0:
+		return pluralize(int(interval/time.Minute), "minute")
+	}
+	return interval.String()
+}
+
+func pluralize(count int, unit string) string {
+	if count == 1 {
+		return unit
+	}
+	return fmt.Sprintf("%d %ss", count, unit)
+}
+
+// everyOtherSchedule keeps only the executions of the base schedule that are
+// an even number of days or weeks after its first execution after the anchor.
+type everyOtherSchedule struct {
+	Base   Schedule
+	Anchor time.Time
+	Weekly bool
+}
+
+func (s *everyOtherSchedule) period(t time.Time) int {
+	days := int(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / (24 * 60 * 60))
+	if s.Weekly {
+		// The Unix epoch was a Thursday, so the weeks start on Monday
+		return (days + 3) / 7
+	}
+	return days
+}
+
+func (s *everyOtherSchedule) Next(from time.Time) time.Time {
+	first := s.Base.Next(s.Anchor.In(from.Location()))
+	if first.IsZero() || first.After(from) {
+		return first
+	}
+	next := from
+	for i := 0; i < maxScheduleLookahead; i++ {
+		next = s.Base.Next(next)
+		if next.IsZero() || (s.period(next)-s.period(first))%2 == 0 {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+func (s *everyOtherSchedule) String() string {
+	if s.Weekly {
+		return s.Base.String() + ", every other week"
+	}
+	return s.Base.String() + ", every other day"
+}
+
+var (
+	englishTimeRegexp         = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?\s*(am|pm)?$`)
+	englishMonthDayRegexp     = regexp.MustCompile(`^(?:day\s+)?(\d{1,2})(?:st|nd|rd|th)?$`)
+	englishIntervalRegexp     = regexp.MustCompile(`^(\d+)\s+(minute|hour|day)s?$`)
+	englishDaySeparatorRegexp = regexp.MustCompile(`\s*(?:,|\band\b)\s*`)
+)
+
+var englishWeekdays = map[string]int{
+	"sunday": 0, "sun": 0,
+	"monday": 1, "mon": 1,
+	"tuesday": 2, "tue": 2, "tues": 2,
+	"wednesday": 3, "wed": 3,
+	"thursday": 4, "thu": 4, "thurs": 4,
+	"friday": 5, "fri": 5,
+	"saturday": 6, "sat": 6,
+}
+
+// parseEnglishSchedule parses schedules like "every weekday at 10:00",
+// "every monday and thursday at 9am", "every other monday at 9",
+// "every month on the 15th at 12:00", "every day" or "every 36 hours".
+func parseEnglishSchedule(source string, anchor time.Time) (Schedule, error) {
+	text := strings.Join(strings.Fields(strings.TrimPrefix(source, "every ")), " ")
+
+	if match := englishIntervalRegexp.FindStringSubmatch(text); match != nil {
+		count, _ := strconv.Atoi(match[1])
+		unit := map[string]time.Duration{"minute": time.Minute, "hour": time.Hour, "day": 24 * time.Hour}[match[2]]
+		if count == 0 {
+			return nil, errors.New("the interval must be greater than zero")
+		}
+		return &intervalSchedule{Interval: time.Duration(count) * unit, Anchor: anchor}, nil
+	}
+
+	other := false
+	if strings.HasPrefix(text, "other ") {
+		other = true
+		text = strings.TrimPrefix(text, "other ")
+	}
+
+	hour, minute := 0, 0
+	if idx := strings.LastIndex(text, " at "); idx >= 0 {
+		var err error
+		hour, minute, err = parseEnglishTime(text[idx+len(" at "):])
+		if err != nil {
+			return nil, err
+		}
+		text = text[:idx]
+	}
+
+	dayOfMonth, dayOfWeek := "*", "*"
+	weekly := false
+	switch {
+	case text == "day":
+	case text == "weekday" || text == "weekdays":
+		dayOfWeek = "1-5"
+	case text == "weekend" || text == "weekends" || text == "weekend day":
+		dayOfWeek = "0,6"
+	case text == "week":
+		dayOfWeek = "1"
+		weekly = true
+	case text == "month":
+		dayOfMonth = "1"
+	case strings.HasPrefix(text, "month on the ") || strings.HasPrefix(text, "month on "):
+		day := strings.TrimPrefix(strings.TrimPrefix(text, "month on "), "the ")
+		match := englishMonthDayRegexp.FindStringSubmatch(day)
+		if match == nil {
+			return nil, errors.Errorf("invalid day of the month %q", day)
+		}
+		if value, _ := strconv.Atoi(match[1]); value < 1 || value > 31 {
+			return nil, errors.Errorf("invalid day of the month %q", day)
+		}
+		dayOfMonth = match[1]
+	default:
+		days := []string{}
+		for _, name := range englishDaySeparatorRegexp.Split(text, -1) {
+			if name == "" {
+				continue
+			}
+			weekday, ok := englishWeekdays[strings.TrimSuffix(name, "s")]
+			if !ok {
+				weekday, ok = englishWeekdays[name]
+			}
+			if !ok {
+				return nil, errors.Errorf("unable to understand %q, use a day of the week, day, weekday, weekend, week or month", name)
+			}
+			days = append(days, strconv.Itoa(weekday))
+		}
+		if len(days) == 0 {
+			return nil, errors.New("missing the days of the schedule")
+		}
+		dayOfWeek = strings.Join(days, ",")
+		weekly = true
+	}
+
+	if other && dayOfMonth != "*" {
+		return nil, errors.New("\"every other\" can't be used with months")
+	}
+
+	schedule, err := newCronSchedule(fmt.Sprintf("%d %d %s * %s", minute, hour, dayOfMonth, dayOfWeek))
+	if err != nil {
+		return nil, err
+	}
+	if other {
+		return &everyOtherSchedule{Base: schedule, Anchor: anchor, Weekly: weekly}, nil
+	}
+	return schedule, nil
+}
+
+func parseEnglishTime(text string) (int, int, error) {
+	switch text {
+	case "noon":
+		return 12, 0, nil
+	case "midnight":
+		return 0, 0, nil
+	}
+	match := englishTimeRegexp.FindStringSubmatch(text)
+	if match == nil {
+		return 0, 0, errors.Errorf("invalid time %q, use a time like 10:00 or 9am", text)
+	}
+	hour, _ := strconv.Atoi(match[1])
+	minute := 0
+	if match[2] != "" {
+		minute, _ = strconv.Atoi(match[2])
+	}
+	if match[3] != "" {
+		if hour < 1 || hour > 12 {
+			return 0, 0, errors.Errorf("invalid time %q", text)
+		}
+		hour = hour % 12
+		if match[3] == "pm" {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0, 0, errors.Errorf("invalid time %q", text)
+	}
+	return hour, minute, nil
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	cronNumberRegexp = regexp.MustCompile(`^\d+$`)
+	cronStepRegexp   = regexp.MustCompile(`^\*/(\d+)$`)
+	cronRangeRegexp  = regexp.MustCompile(`^(\d+)-(\d+)$`)
+	cronNthRegexp    = regexp.MustCompile(`^(\d)#([1-5])$`)
+)
+
+var cronWeekdayNames = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}
+
+var ordinals = []string{"", "first", "second", "third", "fourth", "fifth"}
+
+// describeCron returns a human readable description of the most common cron
+// expressions, falling back to the expression itself for the rest.
+func describeCron(source string) string {
+	fallback := fmt.Sprintf("Cron expression `%s`", source)
+	if expanded, ok := cronDescriptors[strings.ToLower(source)]; ok {
+		source = expanded
+	}
+	fields := strings.Fields(source)
+	if len(fields) != 5 {
+		return fallback
+	}
+	minute, hour, dayOfMonth, month, dayOfWeek := fields[0], fields[1], fields[2], fields[3], fields[4]
+
+	timeText := describeCronTime(minute, hour)
+	daysText := describeCronDays(dayOfMonth, dayOfWeek)
+	monthsText, ok := describeCronMonths(month)
+	if timeText == "" || daysText == "" || !ok {
+		return fallback
+	}
+	return strings.TrimSpace(timeText + " " + daysText + " " + monthsText)
+}
+
+func describeCronTime(minute, hour string) string {
+	hours := cronList(hour)
+	switch {
+	case minute == "*" && hour == "*":
+		return "Every minute,"
+	case cronStepRegexp.MatchString(minute) && hour == "*":
+		step, _ := strconv.Atoi(cronStepRegexp.FindStringSubmatch(minute)[1])
+		return "Every " + pluralize(step, "minute") + ","
+	case cronNumberRegexp.MatchString(minute) && hour == "*":
+		if minute == "0" {
+			return "Every hour,"
+		}
+		return fmt.Sprintf("Every hour at minute %s,", minute)
+	case cronNumberRegexp.MatchString(minute) && cronRangeRegexp.MatchString(hour):
+		match := cronRangeRegexp.FindStringSubmatch(hour)
+		from, _ := strconv.Atoi(match[1])
+		to, _ := strconv.Atoi(match[2])
+		m, _ := strconv.Atoi(minute)
+		return fmt.Sprintf("Every hour from %02d:%02d to %02d:%02d,", from, m, to, m)
+	case cronNumberRegexp.MatchString(minute) && hours != nil:
+		m, _ := strconv.Atoi(minute)
+		times := []string{}
+		for _, h := range hours {
+			times = append(times, fmt.Sprintf("%02d:%02d", h, m))
+		}
+		return "At " + joinWords(times)
+	}
+	return ""
+}
+
+func describeCronDays(dayOfMonth, dayOfWeek string) string {
+	if dayOfMonth == "?" {
+		dayOfMonth = "*"
+	}
+	if dayOfWeek == "?" {
+		dayOfWeek = "*"
+	}
+
+	switch {
+	case dayOfMonth == "*" && dayOfWeek == "*":
+		return "every day"
+	case dayOfMonth == "*" && (dayOfWeek == "1-5" || dayOfWeek == "mon-fri"):
+		return "on weekdays"
+	case dayOfMonth == "*" && (dayOfWeek == "0,6" || dayOfWeek == "6,0" || dayOfWeek == "sat,sun"):
+		return "on weekends"
+	case dayOfMonth == "*":
+		days := []string{}
+		for _, item := range strings.Split(dayOfWeek, ",") {
+			if match := cronNthRegexp.FindStringSubmatch(item); match != nil {
+				weekday, _ := strconv.Atoi(match[1])
+				nth, _ := strconv.Atoi(match[2])
+				if weekday > 7 {
+					return ""
+				}
+				days = append(days, fmt.Sprintf("the %s %s of the month", ordinals[nth], cronWeekdayNames[weekday]))
+				continue
+			}
+			if match := cronRangeRegexp.FindStringSubmatch(item); match != nil {
+				from, _ := strconv.Atoi(match[1])
+				to, _ := strconv.Atoi(match[2])
+				if from > 7 || to > 7 {
+					return ""
+				}
+				days = append(days, cronWeekdayNames[from]+" to "+cronWeekdayNames[to])
+				continue
+			}
+			weekday, ok := englishWeekdays[strings.ToLower(item)]
+			if !ok {
+				number, err := strconv.Atoi(item)
+				if err != nil || number > 7 {
+					return ""
+				}
+				weekday = number
+			}
+			days = append(days, cronWeekdayNames[weekday])
+		}
+		return "on " + joinWords(days)
+	case dayOfWeek == "*" && dayOfMonth == "L":
+		return "on the last day of the month"
+	case dayOfWeek == "*":
+		days := cronList(dayOfMonth)
+		if days == nil {
+			return ""
+		}
+		texts := []string{}
+		for _, day := range days {
+			texts = append(texts, strconv.Itoa(day))
+		}
+		return "on day " + joinWords(texts) + " of the month"
+	}
+	return ""
+}
+
+func describeCronMonths(month string) (string, bool) {
+	if month == "*" {
+		return "", true
+	}
+	months := cronList(month)
+	if months == nil {
+		return "", false
+	}
+	names := []string{}
+	for _, m := range months {
+		if m < 1 || m > 12 {
+			return "", false
+		}
+		names = append(names, time.Month(m).String())
+	}
+	return "in " + joinWords(names), true
+}
+
+// cronList returns the values of a cron field made of a comma separated list
+// of numbers, or nil if the field is not a list of numbers.
+func cronList(field string) []int {
+	values := []int{}
+	for _, item := range strings.Split(field, ",") {
+		if !cronNumberRegexp.MatchString(item) {
+			return nil
+		}
+		value, _ := strconv.Atoi(item)
+		values = append(values, value)
+	}
+	return values
+}
+
+func joinWords(words []string) string {
+	if len(words) == 1 {
+		return words[0]
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " and " + words[len(words)-1]
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorhill/cronexpr"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextInLocation(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	require.NoError(t, err)
+
+	t.Run("evaluated in the location", func(t *testing.T) {
+		spec := cronexpr.MustParse("0 10 * * 1-5")
+		next := nextInLocation(spec, time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC), madrid)
+		assert.Equal(t, time.Date(2026, 10, 19, 10, 0, 0, 0, madrid), next)
+		assert.Equal(t, time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC), next.UTC())
+	})
+
+	t.Run("skipped time when the clock moves forward", func(t *testing.T) {
+		spec := cronexpr.MustParse("30 2 * * *")
+		next := nextInLocation(spec, time.Date(2026, 3, 29, 0, 0, 0, 0, madrid), madrid)
+		assert.Equal(t, time.Date(2026, 3, 29, 1, 30, 0, 0, time.UTC), next.UTC())
+		next = nextInLocation(spec, next, madrid)
+		assert.Equal(t, time.Date(2026, 3, 30, 0, 30, 0, 0, time.UTC), next.UTC())
+	})
+
+	t.Run("repeated time when the clock moves backward", func(t *testing.T) {
+		spec := cronexpr.MustParse("30 2 * * *")
+		next := nextInLocation(spec, time.Date(2026, 10, 25, 0, 0, 0, 0, madrid), madrid)
+		assert.Equal(t, 25, next.Day())
+		next = nextInLocation(spec, next, madrid)
+		assert.Equal(t, time.Date(2026, 10, 26, 1, 30, 0, 0, time.UTC), next.UTC())
+	})
+}
+
+func mustParseSchedule(t *testing.T, source string) Schedule {
+	schedule, err := parseSchedule(source, time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC), time.UTC)
+	require.NoError(t, err)
+	return schedule
+}
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	nextExecutions := func(schedule Schedule, count int) []time.Time {
+		executions := []time.Time{}
+		next := from
+		for i := 0; i < count; i++ {
+			next = schedule.Next(next)
+			executions = append(executions, next)
+		}
+		return executions
+	}
+
+	for _, tc := range []struct {
+		source      string
+		description string
+		next        []time.Time
+	}{
+		{
+			source:      "0 10 * * 1-5",
+			description: "At 10:00 on weekdays",
+			next:        []time.Time{time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC), time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC)},
+		},
+		{
+			source:      "@daily",
+			description: "At 00:00 every day",
+			next:        []time.Time{time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			source:      "@every 36h",
+			description: "Every 36 hours",
+			next:        []time.Time{time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)},
+		},
+		{
+			source:      "every weekday at 10:00",
+			description: "At 10:00 on weekdays",
+			next:        []time.Time{time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC), time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC)},
+		},
+		{
+			source:      "every other monday at 9",
+			description: "At 09:00 on Monday, every other week",
+			next:        []time.Time{time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC), time.Date(2026, 11, 2, 9, 0, 0, 0, time.UTC)},
+		},
+		{
+			source:      "every tuesday and thursday at 5:30pm",
+			description: "At 17:30 on Tuesday and Thursday",
+			next:        []time.Time{time.Date(2026, 10, 20, 17, 30, 0, 0, time.UTC), time.Date(2026, 10, 22, 17, 30, 0, 0, time.UTC)},
+		},
+		{
+			source:      "every month on the 15th at noon",
+			description: "At 12:00 on day 15 of the month",
+			next:        []time.Time{time.Date(2026, 11, 15, 12, 0, 0, 0, time.UTC), time.Date(2026, 12, 15, 12, 0, 0, 0, time.UTC)},
+		},
+		{
+			source:      "0 9 * * 2#1,2#3",
+			description: "At 09:00 on the first Tuesday of the month and the third Tuesday of the month",
+			next:        []time.Time{time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC), time.Date(2026, 11, 3, 9, 0, 0, 0, time.UTC)},
+		},
+	} {
+		t.Run(tc.source, func(t *testing.T) {
+			schedule := mustParseSchedule(t, tc.source)
+			assert.Equal(t, tc.description, schedule.String())
+			assert.Equal(t, tc.next, nextExecutions(schedule, len(tc.next)))
+		})
+	}
+
+	for _, source := range []string{"every blursday", "every day at 25:00", "@every 10s", "0 10 * *"} {
+		_, err := parseSchedule(source, from, time.UTC)
+		assert.Error(t, err, source)
+	}
+}
+
+func TestParseUnionSchedule(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	require.NoError(t, err)
+	anchor := time.Date(2026, 10, 1, 12, 0, 0, 0, madrid)
+
+	schedule, err := parseSchedule("0 9 * * 1-5; 0 12 * * 6", anchor, madrid)
+	require.NoError(t, err)
+	assert.Equal(t, "At 09:00 on weekdays; and at 12:00 on Saturday", schedule.String())
+	next := schedule.Next(time.Date(2026, 10, 16, 10, 0, 0, 0, madrid))
+	assert.Equal(t, time.Date(2026, 10, 17, 12, 0, 0, 0, madrid), next)
+	next = schedule.Next(next)
+	assert.Equal(t, time.Date(2026, 10, 19, 9, 0, 0, 0, madrid), next)
+
+	schedule, err = parseSchedule("@every 36h; from 2026-11-02 09:00; until 2026-11-05", anchor, madrid)
+	require.NoError(t, err)
+	assert.Equal(t, "Every 36 hours, from 2026-11-02 09:00, until 2026-11-05 23:59", schedule.String())
+	executions := []time.Time{}
+	for next := schedule.Next(anchor); !next.IsZero(); next = schedule.Next(next) {
+		executions = append(executions, next)
+	}
+	assert.Equal(t, []time.Time{
+		time.Date(2026, 11, 2, 9, 0, 0, 0, madrid),
+		time.Date(2026, 11, 3, 21, 0, 0, 0, madrid),
+		time.Date(2026, 11, 5, 9, 0, 0, 0, madrid),
+	}, executions)
+
+	for _, source := range []string{"from 2026-11-02", "@daily; from 2026-11-02; until 2026-11-01", "@daily; until tomorrow", "@daily; 0 10 * *"} {
+		_, err := parseSchedule(source, anchor, madrid)
+		assert.Error(t, err, source)
+	}
+}
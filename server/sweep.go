@@ -0,0 +1,19 @@
+package main
+
+import "time"
+
+// sweepInterval is how often the channels and the users of the queues and
+// the deferred posts are checked.
+const sweepInterval = time.Hour
+
+// sweep handles the queues and the deferred posts of the archived channels
+// and the deactivated users, and releases the held posts of the users whose
+// quiet hours ended.
+func (p *Plugin) sweep() {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	p.sweepChannels()
+	p.sweepDeactivatedUsers()
+	p.releaseAllHeldPosts()
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// templateMembersPage limits the channel members considered when picking a
+// random member.
+const templateMembersPage = 200
+
+// messageTemplateContext has the information needed to evaluate the variables
+// of a message template when it's sent.
+type messageTemplateContext struct {
+	Now       time.Time
+	ChannelID string
+	// Queued is true for the queue messages, the only ones with a position.
+	Queued bool
+	// Position is the number of the message in the queue sends, starting in 1.
+	Position int
+	// Remaining is the number of messages pending in the queue after this one.
+	Remaining int
+}
+
+// queueMessageVariables are the variables only available in queue messages.
+var queueMessageVariables = []string{"position", "remaining"}
+
+// serverMessageVariables are the variables that need the server.
+var serverMessageVariables = []string{"channel", "members", "randomMember"}
+
+// messageVariablePattern matches the variables of the message templates,
+// like {{date}} or {{date "Monday, January 2"}}, and the quoted strings, like
+// {{"{{"}}. The rest of the text is kept as it is.
+var messageVariablePattern = regexp.MustCompile(`{{\s*([A-Za-z]*)\s*("(?:[^"\\]|\\.)*")?\s*}}`)
+
+// messageVariable returns the value of a variable of the message templates,
+// given its arguments.
+type messageVariable func(args ...string) (string, error)
+
+// isMessageTemplate returns true if the message has template actions, so the
+// messages without them are sent as they are.
+func isMessageTemplate(message string) bool {
+	return strings.Contains(message, "{{")
+}
+
+// messageVariables returns the variables of the message templates that don't
+// need the server. The position and remaining variables are only returned for
+// queue messages.
+func messageVariables(ctx *messageTemplateContext) map[string]messageVariable {
+	variables := map[string]messageVariable{
+		"date": func(args ...string) (string, error) {
+			if len(args) > 0 {
+				return ctx.Now.Format(args[0]), nil
+			}
+			return ctx.Now.Format(calendarDateFormat), nil
+		},
+		"time": func(args ...string) (string, error) {
+			return ctx.Now.Format("15:04"), nil
+		},
+		"weekday": func(args ...string) (string, error) {
+			return ctx.Now.Weekday().String(), nil
+		},
+		"daysUntil": func(args ...string) (string, error) {
+			if len(args) == 0 {
+				return "", errors.New(`daysUntil needs a date, like {{daysUntil "2026-12-25"}}`)
+			}
+			target, err := time.ParseInLocation(calendarDateFormat, args[0], ctx.Now.Location())
+			if err != nil {
+				return "", errors.Errorf("invalid date %s, the format is 2006-01-02", args[0])
+			}
+			today := time.Date(ctx.Now.Year(), ctx.Now.Month(), ctx.Now.Day(), 0, 0, 0, 0, ctx.Now.Location())
+			return strconv.Itoa(int(math.Round(target.Sub(today).Hours() / 24))), nil
+		},
+	}
+	if ctx.Queued {
+		variables["position"] = func(args ...string) (string, error) {
+			return strconv.Itoa(ctx.Position), nil
+		}
+		variables["remaining"] = func(args ...string) (string, error) {
+			return strconv.Itoa(ctx.Remaining), nil
+		}
+	}
+	return variables
+}
+
+// messageTemplateVariables returns all the variables available in the message
+// templates. The ones that need the server are only called when used.
+func (p *Plugin) messageTemplateVariables(ctx *messageTemplateContext) map[string]messageVariable {
+	variables := messageVariables(ctx)
+	variables["channel"] = func(args ...string) (string, error) {
+		channel, appErr := p.API.GetChannel(ctx.ChannelID)
+		if appErr != nil {
+			return "", appErr
+		}
+		return channel.DisplayName, nil
+	}
+	variables["members"] = func(args ...string) (string, error) {
+		stats, appErr := p.API.GetChannelStats(ctx.ChannelID)
+		if appErr != nil {
+			return "", appErr
+		}
+		return strconv.FormatInt(stats.MemberCount, 10), nil
+	}
+	variables["randomMember"] = func(args ...string) (string, error) {
+		users, appErr := p.API.GetUsersInChannel(ctx.ChannelID, model.CHANNEL_SORT_BY_USERNAME, 0, templateMembersPage)
+		if appErr != nil {
+			return "", appErr
+		}
+		candidates := []*model.User{}
+		for _, user := range users {
+			if !user.IsBot && user.DeleteAt == 0 {
+				candidates = append(candidates, user)
+			}
+		}
+		if len(candidates) == 0 {
+			return "", nil
+		}
+		return "@" + candidates[rand.Intn(len(candidates))].Username, nil
+	}
+	return variables
+}
+
+// expandMessageVariables replaces the variables of the message with their
+// values. The unknown variables, like {{ .Values.image }} in a Helm snippet,
+// are kept as they are. The first error is returned with the message
+// expanded as far as possible.
+func expandMessageVariables(message string, variables map[string]messageVariable) (string, error) {
+	var firstErr error
+	expanded := messageVariablePattern.ReplaceAllStringFunc(message, func(match string) string {
+		parts := messageVariablePattern.FindStringSubmatch(match)
+		name, quoted := parts[1], parts[2]
+		args := []string{}
+		if quoted != "" {
+			arg, err := strconv.Unquote(quoted)
+			if err != nil {
+				return match
+			}
+			args = append(args, arg)
+		}
+		if name == "" {
+			if len(args) == 0 {
+				return match
+			}
+			return args[0]
+		}
+		variable, ok := variables[name]
+		if !ok {
+			return match
+		}
+		value, err := variable(args...)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = errors.Wrapf(err, "invalid variable %s", name)
+			}
+			return match
+		}
+		return value
+	})
+	return expanded, firstErr
+}
+
+// validateMessageTemplate checks that the variables of the message can be
+// evaluated, without calling the server. The position and remaining variables
+// are only valid in queue messages.
+func validateMessageTemplate(message string, queued bool) error {
+	if !isMessageTemplate(message) {
+		return nil
+	}
+	variables := messageVariables(&messageTemplateContext{Now: time.Now(), Queued: queued})
+	for _, name := range serverMessageVariables {
+		variables[name] = func(args ...string) (string, error) { return "", nil }
+	}
+	if !queued {
+		for _, name := range queueMessageVariables {
+			variables[name] = func(args ...string) (string, error) {
+				return "", errors.New("it's only available in queue messages")
+			}
+		}
+	}
+	_, err := expandMessageVariables(message, variables)
+	return err
+}
+
+// renderMessage replaces the variables of the message. If a variable fails,
+// the error is returned together with the original message.
+func (p *Plugin) renderMessage(message string, ctx *messageTemplateContext) (string, error) {
+	if !isMessageTemplate(message) {
+		return message, nil
+	}
+	rendered, err := expandMessageVariables(message, p.messageTemplateVariables(ctx))
+	if err != nil {
+		return message, err
+	}
+	return rendered, nil
+}
+
+// renderDeferredPost evaluates the template of a deferred post in the
+// timezone of its author.
+func (p *Plugin) renderDeferredPost(post *model.Post) *model.Post {
+	if !isMessageTemplate(post.Message) {
+		return post
+	}
+	now := time.Now()
+	if user, appErr := p.API.GetUser(post.UserId); appErr == nil {
+		if loc, err := time.LoadLocation(user.GetPreferredTimezone()); err == nil {
+			now = now.In(loc)
+		}
+	}
+	message, err := p.renderMessage(post.Message, &messageTemplateContext{Now: now, ChannelID: post.ChannelId})
+	if err != nil {
+		p.API.LogError("failed to render the deferred post", "err", err.Error())
+	}
+	rendered := post.Clone()
+	rendered.Message = message
+	return rendered
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderMessage(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Madrid")
+	require.NoError(t, err)
+	ctx := &messageTemplateContext{
+		Now:       time.Date(2026, 10, 20, 9, 30, 0, 0, loc),
+		Queued:    true,
+		Position:  3,
+		Remaining: 7,
+	}
+	p := &Plugin{}
+
+	message, err := p.renderMessage(`Tip #{{position}} ({{remaining}} left) for {{weekday}} {{date}} {{date "Jan 2"}} at {{time}}, {{daysUntil "2026-12-25"}} days to go`, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "Tip #3 (7 left) for Tuesday 2026-10-20 Oct 20 at 09:30, 66 days to go", message)
+
+	message, err = p.renderMessage("No {variables} here", ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "No {variables} here", message)
+
+	message, err = p.renderMessage("image: {{ .Values.image }} {{range 1000000000000}}x{{end}} {{date", ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "image: {{ .Values.image }} {{range 1000000000000}}x{{end}} {{date", message)
+
+	_, err = p.renderMessage(`{{daysUntil "christmas"}}`, ctx)
+	assert.Error(t, err)
+
+	ctx.Queued = false
+	message, err = p.renderMessage("Deferred {{position}} {{date}}", ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "Deferred {{position}} 2026-10-20", message)
+}
+
+func TestValidateMessageTemplate(t *testing.T) {
+	assert.NoError(t, validateMessageTemplate("Plain message", true))
+	assert.NoError(t, validateMessageTemplate(`Welcome to {{channel}}, {{randomMember}}! We are {{members}}`, true))
+	assert.NoError(t, validateMessageTemplate(`Literal {{"{{"}}braces}}`, true))
+	assert.NoError(t, validateMessageTemplate("Helm {{ .Values.image }} and unknown {{function}}", true))
+	assert.Error(t, validateMessageTemplate("Missing date {{daysUntil}}", true))
+	assert.Error(t, validateMessageTemplate(`Bad date {{daysUntil "tomorrow"}}`, true))
+
+	assert.NoError(t, validateMessageTemplate("Tip #{{position}}, {{remaining}} left", true))
+	assert.Error(t, validateMessageTemplate("Tip #{{position}}", false))
+	assert.Error(t, validateMessageTemplate("{{remaining}} left", false))
+	assert.NoError(t, validateMessageTemplate("Deferred on {{weekday}}", false))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// deactivationChecker returns a function that tells if a user was
+// deactivated, getting each user only once.
+func (p *Plugin) deactivationChecker() func(userID string) bool {
+	deactivated := map[string]bool{}
+	return func(userID string) bool {
+		if _, ok := deactivated[userID]; !ok {
+			user, appErr := p.API.GetUser(userID)
+			deactivated[userID] = appErr == nil && user.DeleteAt != 0
+		}
+		return deactivated[userID]
+	}
+}
+
+// sweepDeactivatedUsers cancels or transfers the deferred posts and the
+// queues of the deactivated users, following the configuration. The posts
+// waiting for a deactivated user to be online, or held during its quiet
+// hours, are always cancelled, as they would never be sent. The held posts
+// are direct messages, so they can't be transferred and are cancelled unless
+// the configuration keeps them.
+func (p *Plugin) sweepDeactivatedUsers() {
+	policy := p.getConfiguration().DeactivatedUserPolicy
+	isDeactivated := p.deactivationChecker()
+
+	cancelled := []string{}
+	transferred := false
+	handle := func(post *model.Post) {
+		if !isDeactivated(post.UserId) || policy == deactivatedUserPolicyKeep {
+			return
+		}
+		if policy == deactivatedUserPolicyCancel {
+			cancelled = append(cancelled, post.Id)
+			return
+		}
+		post.Message = strings.TrimSpace(post.Message + "\n\n" + p.onBehalfOf(post.UserId))
+		post.UserId = p.botUserID
+		transferred = true
+	}
+	for _, deferredPost := range p.deferredPosts {
+		handle(deferredPost.Post)
+	}
+	for recipientID, posts := range p.postsWaitingForOnline {
+		for _, post := range posts {
+			if !isDeactivated(recipientID) {
+				handle(post)
+				continue
+			}
+			cancelled = append(cancelled, post.Id)
+			if !isDeactivated(post.UserId) {
+				p.notifyUser(post.UserId, fmt.Sprintf("Your message waiting for %s to be online was cancelled because the user was deactivated:\n%s", p.onlineRecipientName(recipientID), previewMessage(post.Message)))
+			}
+		}
+	}
+	for recipientID, posts := range p.heldPostsByUser() {
+		for _, post := range posts {
+			if !isDeactivated(recipientID) {
+				if isDeactivated(post.UserId) && policy != deactivatedUserPolicyKeep {
+					cancelled = append(cancelled, post.Id)
+				}
+				continue
+			}
+			cancelled = append(cancelled, post.Id)
+			if !isDeactivated(post.UserId) {
+				p.notifyUser(post.UserId, fmt.Sprintf("Your message held during the quiet hours of %s was cancelled because the user was deactivated:\n%s", p.onlineRecipientName(recipientID), previewMessage(post.Message)))
+			}
+		}
+	}
+	if transferred {
+		p.SaveDeferredPosts()
+		p.SaveWaitingForOnlinePosts()
+	}
+	p.cancelDeferredPosts(cancelled)
+
+	if policy == deactivatedUserPolicyKeep {
+		return
+	}
+	for _, queue := range p.Queues {
+		if queue.Paused || queue.Archived || queue.CompletedAt != 0 || !isDeactivated(queue.UserId) {
+			continue
+		}
+		if policy == deactivatedUserPolicyTransfer && p.transferQueue(queue, isDeactivated) {
+			continue
+		}
+		p.pauseQueueForAuthor(queue, errors.New("its author was deactivated"))
+	}
+}
+
+// transferQueue makes the first active owner of the queue its author, and
+// removes the deactivated owners. It returns false if there are no active
+// owners.
+func (p *Plugin) transferQueue(queue *Queue, isDeactivated func(userID string) bool) bool {
+	owners := []string{}
+	for _, ownerID := range queue.OwnerIds {
+		if !isDeactivated(ownerID) {
+			owners = append(owners, ownerID)
+		}
+	}
+	if len(owners) == 0 {
+		return false
+	}
+	queue.UserId = owners[0]
+	queue.OwnerIds = owners
+	nErr := p.SaveQueues()
+	if nErr != nil {
+		p.API.LogError(nErr.Error())
+	}
+	p.notifyUser(queue.UserId, fmt.Sprintf("The queue %s was transferred to you because its author was deactivated, its messages are sent as you now.", queue.Name))
+	return true
+}
+
+// onlineRecipientName returns the mention of the user, or a generic name if
+// it can't be found.
+func (p *Plugin) onlineRecipientName(userID string) string {
+	if user, appErr := p.API.GetUser(userID); appErr == nil {
+		return "@" + user.Username
+	}
+	return "the other user"
+}
+
+// orphanedQueues returns the queues whose author was deactivated.
+func (p *Plugin) orphanedQueues() []*Queue {
+	isDeactivated := p.deactivationChecker()
+	queues := []*Queue{}
+	for _, queue := range p.Queues {
+		if isDeactivated(queue.UserId) {
+			queues = append(queues, queue)
+		}
+	}
+	sort.Slice(queues, func(i, j int) bool {
+		return queues[i].Name < queues[j].Name
+	})
+	return queues
+}
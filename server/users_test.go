@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newUsersTestPlugin returns a plugin with the active users alice and carol,
+// the deactivated user bob, and the API calls to save and notify mocked.
+func newUsersTestPlugin(t *testing.T, policy string) (*Plugin, *plugintest.API) {
+	api := &plugintest.API{}
+	for _, user := range []*model.User{
+		{Id: "alice", Username: "alice"},
+		{Id: "bob", Username: "bob", DeleteAt: 1},
+		{Id: "carol", Username: "carol"},
+	} {
+		api.On("GetUser", user.Id).Return(user, nil)
+	}
+	api.On("KVSet", mock.Anything, mock.Anything).Return(nil)
+	api.On("GetDirectChannel", mock.Anything, "bot").Return(func(userID string, botID string) *model.Channel {
+		return &model.Channel{Id: "dm-" + userID}
+	}, nil)
+	api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+
+	p := &Plugin{botUserID: "bot", postsWaitingForOnline: map[string][]*model.Post{}}
+	p.SetAPI(api)
+	p.setConfiguration(&configuration{DeactivatedUserPolicy: policy})
+	return p, api
+}
+
+func assertNotified(t *testing.T, api *plugintest.API, userID string, message string) {
+	api.AssertCalled(t, "CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.UserId == "bot" && post.ChannelId == "dm-"+userID && post.Message == message
+	}))
+}
+
+func TestTransferQueue(t *testing.T) {
+	p, api := newUsersTestPlugin(t, deactivatedUserPolicyTransfer)
+	isDeactivated := p.deactivationChecker()
+
+	queue := &Queue{Name: "tips", UserId: "bob", OwnerIds: []string{"bob", "carol", "alice"}}
+	p.Queues = map[string]*Queue{"tips": queue}
+	require.True(t, p.transferQueue(queue, isDeactivated))
+	assert.Equal(t, "carol", queue.UserId)
+	assert.Equal(t, []string{"carol", "alice"}, queue.OwnerIds)
+	api.AssertCalled(t, "KVSet", "queues", mock.Anything)
+	assertNotified(t, api, "carol", "The queue tips was transferred to you because its author was deactivated, its messages are sent as you now.")
+
+	orphaned := &Queue{Name: "news", UserId: "bob", OwnerIds: []string{"bob"}}
+	assert.False(t, p.transferQueue(orphaned, isDeactivated))
+	assert.Equal(t, "bob", orphaned.UserId)
+	assert.Equal(t, []string{"bob"}, orphaned.OwnerIds)
+}
+
+func TestSweepDeactivatedUsersCancel(t *testing.T) {
+	p, api := newUsersTestPlugin(t, deactivatedUserPolicyCancel)
+	p.deferredPosts = []*DeferredPost{
+		{Time: time.Now().Add(time.Hour), Post: &model.Post{Id: "post1", UserId: "bob", Message: "From bob"}},
+		{Time: time.Now().Add(time.Hour), Post: &model.Post{Id: "post2", UserId: "alice", Message: "From alice"}},
+	}
+	p.postsWaitingForOnline["bob"] = []*model.Post{{Id: "post3", UserId: "alice", Message: "For bob"}}
+	queue := &Queue{Name: "tips", UserId: "bob", OwnerIds: []string{"bob", "carol"}}
+	p.Queues = map[string]*Queue{"tips": queue}
+
+	p.sweepDeactivatedUsers()
+
+	require.Len(t, p.deferredPosts, 1)
+	assert.Equal(t, "post2", p.deferredPosts[0].Post.Id)
+	assert.Empty(t, p.postsWaitingForOnline["bob"])
+	assertNotified(t, api, "alice", "Your message waiting for @bob to be online was cancelled because the user was deactivated:\nFor bob")
+	assert.True(t, queue.Paused)
+	assert.Equal(t, "bob", queue.UserId)
+	assertNotified(t, api, "carol", "The queue tips was paused because its author was deactivated. Resume it with `/messages-queue resume tips` when the author can post again.")
+}
+
+func TestSweepDeactivatedUsersTransfer(t *testing.T) {
+	p, api := newUsersTestPlugin(t, deactivatedUserPolicyTransfer)
+	p.deferredPosts = []*DeferredPost{
+		{Time: time.Now().Add(time.Hour), Post: &model.Post{Id: "post1", UserId: "bob", Message: "From bob"}},
+	}
+	p.postsWaitingForOnline["alice"] = []*model.Post{{Id: "post2", UserId: "bob", Message: "For alice"}}
+	queue := &Queue{Name: "tips", UserId: "bob", OwnerIds: []string{"bob", "carol"}}
+	orphaned := &Queue{Name: "news", UserId: "bob"}
+	p.Queues = map[string]*Queue{"tips": queue, "news": orphaned}
+
+	p.sweepDeactivatedUsers()
+
+	require.Len(t, p.deferredPosts, 1)
+	assert.Equal(t, "bot", p.deferredPosts[0].Post.UserId)
+	assert.Equal(t, "From bob\n\n_Sent on behalf of @bob_", p.deferredPosts[0].Post.Message)
+	require.Len(t, p.postsWaitingForOnline["alice"], 1)
+	assert.Equal(t, "bot", p.postsWaitingForOnline["alice"][0].UserId)
+	api.AssertCalled(t, "KVSet", "deferred-posts", mock.Anything)
+
+	assert.False(t, queue.Paused)
+	assert.Equal(t, "carol", queue.UserId)
+	assert.True(t, orphaned.Paused)
+}
+
+func TestSweepDeactivatedUsersKeep(t *testing.T) {
+	p, api := newUsersTestPlugin(t, deactivatedUserPolicyKeep)
+	p.deferredPosts = []*DeferredPost{
+		{Time: time.Now().Add(time.Hour), Post: &model.Post{Id: "post1", UserId: "bob", Message: "From bob"}},
+	}
+	queue := &Queue{Name: "tips", UserId: "bob", OwnerIds: []string{"bob", "carol"}}
+	p.Queues = map[string]*Queue{"tips": queue}
+
+	p.sweepDeactivatedUsers()
+
+	require.Len(t, p.deferredPosts, 1)
+	assert.Equal(t, "bob", p.deferredPosts[0].Post.UserId)
+	assert.False(t, queue.Paused)
+	api.AssertNotCalled(t, "CreatePost", mock.Anything)
+}
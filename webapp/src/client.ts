@@ -4,12 +4,80 @@ import {ClientError} from 'mattermost-redux/client/client4';
 export default class Client {
       constructor() {
           this.url = '/plugins/com.github.jespino.messages-queue/';
+          this.apiUrl = this.url + 'api/v1';
       }
   
       getConnected = async () => {
           return this.doPost(this.url);
       }
 
+      getConfig = async () => {
+          return this.doGet(`${this.apiUrl}/config`);
+      }
+
+      getQueues = async (channelId = '') => {
+          return this.doGet(`${this.apiUrl}/queues?channel_id=${encodeURIComponent(channelId)}`);
+      }
+
+      addPostToQueue = async (queueName, postId) => {
+          return this.doPost(`${this.apiUrl}/queues/${encodeURIComponent(queueName)}/posts`, {post_id: postId});
+      }
+
+      deferPostCopy = async (postId, delay, sendAt = 0) => {
+          return this.doPost(`${this.apiUrl}/deferred`, {post_id: postId, delay, send_at: sendAt});
+      }
+
+      getQueue = async (queueName) => {
+          return this.doGet(this.queueUrl(queueName));
+      }
+
+      pauseQueue = async (queueName) => {
+          return this.doPost(`${this.queueUrl(queueName)}/pause`);
+      }
+
+      resumeQueue = async (queueName) => {
+          return this.doPost(`${this.queueUrl(queueName)}/resume`);
+      }
+
+      setQueueSchedule = async (queueName, schedule) => {
+          return this.doPut(`${this.queueUrl(queueName)}/schedule`, {schedule});
+      }
+
+      addQueueMessage = async (queueName, message) => {
+          return this.doPost(`${this.queueUrl(queueName)}/messages`, {message});
+      }
+
+      editQueueMessage = async (queueName, messageId, message) => {
+          return this.doPut(`${this.queueUrl(queueName)}/messages/${encodeURIComponent(messageId)}`, {message});
+      }
+
+      deleteQueueMessage = async (queueName, messageId) => {
+          return this.doFetch(`${this.queueUrl(queueName)}/messages/${encodeURIComponent(messageId)}`, {method: 'delete'});
+      }
+
+      reorderQueueMessages = async (queueName, ids) => {
+          return this.doPut(`${this.queueUrl(queueName)}/messages`, {ids});
+      }
+
+      importQueueMessages = async (queueName, file) => {
+          const body = new FormData();
+          body.append('file', file);
+          return this.doFetch(`${this.queueUrl(queueName)}/import?dry_run=false`, {method: 'post', body});
+      }
+
+      queueUrl = (queueName) => {
+          return `${this.apiUrl}/queues/${encodeURIComponent(queueName)}`;
+      }
+
+      doGet = async (url, headers = {}) => {
+          const options = {
+              method: 'get',
+              headers,
+          };
+
+          return this.doFetch(url, options);
+      }
+
       doPost = async (url, body, headers = {}) => {
           headers['X-Timezone-Offset'] = new Date().getTimezoneOffset();
   
@@ -19,6 +87,20 @@ export default class Client {
               headers,
           };
   
+          return this.doFetch(url, options);
+      }
+
+      doPut = async (url, body, headers = {}) => {
+          const options = {
+              method: 'put',
+              body: JSON.stringify(body),
+              headers,
+          };
+
+          return this.doFetch(url, options);
+      }
+
+      doFetch = async (url, options) => {
           const response = await fetch(url, Client4.getOptions(options));
   
           if (response.ok) {
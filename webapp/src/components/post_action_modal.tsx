@@ -0,0 +1,200 @@
+import React from 'react';
+import {Modal} from 'react-bootstrap';
+
+import Client from '../client';
+import {PostAction, openPostAction, subscribePostActions} from '../post_actions';
+import {config} from '../config';
+
+interface Queue {
+    name: string;
+    channel_id: string;
+    schedule: string;
+    pending: number;
+}
+
+interface State {
+    action: PostAction | null;
+    queues: Queue[];
+    queueName: string;
+    delay: string;
+    sendAt: string;
+    error: string;
+    saving: boolean;
+}
+
+const delays = ['30m', '1h', '2h', '4h', '24h', 'online'];
+
+// errorMessage extracts the message of the plugin API errors.
+export function errorMessage(e: Error): string {
+    try {
+        return JSON.parse(e.message).message || e.message;
+    } catch (err) {
+        return e.message;
+    }
+}
+
+// PostActionModal is the dialog of the "Add to queue" and "Defer copy" post
+// menu actions.
+export default class PostActionModal extends React.PureComponent<{}, State> {
+    private unsubscribe: (() => void) | null = null;
+
+    constructor(props: {}) {
+        super(props);
+        this.state = {
+            action: null,
+            queues: [],
+            queueName: '',
+            delay: '1h',
+            sendAt: '',
+            error: '',
+            saving: false,
+        };
+    }
+
+    public componentDidMount(): void {
+        this.unsubscribe = subscribePostActions(this.open);
+    }
+
+    public componentWillUnmount(): void {
+        if (this.unsubscribe) {
+            this.unsubscribe();
+        }
+    }
+
+    private open = async (action: PostAction | null): Promise<void> => {
+        this.setState({action, error: '', saving: false});
+        if (action && action.type === 'queue') {
+            try {
+                const queues: Queue[] = await (new Client()).getQueues();
+
+                // The queues of the channel of the post are shown first
+                queues.sort((a, b) => Number(b.channel_id === action.channelId) - Number(a.channel_id === action.channelId));
+                this.setState({queues, queueName: queues.length > 0 ? queues[0].name : ''});
+            } catch (e) {
+                this.setState({error: errorMessage(e)});
+            }
+        }
+    }
+
+    private close = (): void => {
+        openPostAction(null);
+    }
+
+    private submit = async (): Promise<void> => {
+        const {action, queueName, delay, sendAt} = this.state;
+        if (!action) {
+            return;
+        }
+        this.setState({saving: true, error: ''});
+        try {
+            const client = new Client();
+            if (action.type === 'queue') {
+                await client.addPostToQueue(queueName, action.postId);
+            } else if (delay === 'custom') {
+                await client.deferPostCopy(action.postId, '', new Date(sendAt).getTime());
+            } else {
+                await client.deferPostCopy(action.postId, delay);
+            }
+            this.close();
+        } catch (e) {
+            this.setState({saving: false, error: errorMessage(e)});
+        }
+    }
+
+    private renderQueueForm(): React.ReactNode {
+        if (this.state.queues.length === 0) {
+            return <p>{'There are no queues yet, create one with /messages-queue create.'}</p>;
+        }
+        return (
+            <div className='form-group'>
+                <label htmlFor='messages-queue-name'>{'Queue'}</label>
+                <select
+                    id='messages-queue-name'
+                    className='form-control'
+                    value={this.state.queueName}
+                    onChange={(e) => this.setState({queueName: e.target.value})}
+                >
+                    {this.state.queues.map((queue) => (
+                        <option
+                            key={queue.name}
+                            value={queue.name}
+                        >
+                            {`${queue.name} (${queue.schedule}, ${queue.pending} pending)`}
+                        </option>
+                    ))}
+                </select>
+            </div>
+        );
+    }
+
+    private renderDeferForm(): React.ReactNode {
+        return (
+            <div className='form-group'>
+                <label htmlFor='messages-queue-delay'>{'Send the copy'}</label>
+                <select
+                    id='messages-queue-delay'
+                    className='form-control'
+                    value={this.state.delay}
+                    onChange={(e) => this.setState({delay: e.target.value})}
+                >
+                    {delays.filter((delay) => delay !== 'online' || config.enableOnlineDeferral).map((delay) => (
+                        <option
+                            key={delay}
+                            value={delay}
+                        >
+                            {delay === 'online' ? 'When the user is online (only DMs)' : `In ${delay}`}
+                        </option>
+                    ))}
+                    <option value='custom'>{'At a specific time'}</option>
+                </select>
+                {this.state.delay === 'custom' &&
+                    <input
+                        type='datetime-local'
+                        className='form-control'
+                        value={this.state.sendAt}
+                        onChange={(e) => this.setState({sendAt: e.target.value})}
+                    />
+                }
+            </div>
+        );
+    }
+
+    public render(): React.ReactNode {
+        const {action, error, saving} = this.state;
+        if (!action) {
+            return null;
+        }
+        const isQueue = action.type === 'queue';
+        return (
+            <Modal
+                show={true}
+                onHide={this.close}
+            >
+                <Modal.Header closeButton={true}>
+                    <Modal.Title>{isQueue ? 'Add to queue' : 'Defer copy'}</Modal.Title>
+                </Modal.Header>
+                <Modal.Body>
+                    {isQueue ? this.renderQueueForm() : this.renderDeferForm()}
+                    {error && <div className='error-text'>{error}</div>}
+                </Modal.Body>
+                <Modal.Footer>
+                    <button
+                        type='button'
+                        className='btn btn-link'
+                        onClick={this.close}
+                    >
+                        {'Cancel'}
+                    </button>
+                    <button
+                        type='button'
+                        className='btn btn-primary'
+                        disabled={saving || (isQueue && !this.state.queueName)}
+                        onClick={this.submit}
+                    >
+                        {isQueue ? 'Add' : 'Defer'}
+                    </button>
+                </Modal.Footer>
+            </Modal>
+        );
+    }
+}
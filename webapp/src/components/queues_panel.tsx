@@ -0,0 +1,342 @@
+import React from 'react';
+import {connect} from 'react-redux';
+import {getCurrentChannelId} from 'mattermost-redux/selectors/entities/channels';
+
+import Client from '../client';
+
+import {errorMessage} from './post_action_modal';
+
+interface QueueMessage {
+    id: string;
+    message: string;
+    file_ids?: string[];
+}
+
+interface Queue {
+    name: string;
+    channel_id: string;
+    schedule: string;
+    timezone: string;
+    pending: number;
+    next_execution?: number;
+    paused?: boolean;
+    archived?: boolean;
+    lifecycle?: string;
+    messages?: QueueMessage[];
+}
+
+interface Props {
+    channelId: string;
+}
+
+interface State {
+    queues: Queue[];
+    selected: Queue | null;
+    editingMessageId: string;
+    editingSchedule: boolean;
+    draft: string;
+    newMessage: string;
+    draggedMessageId: string;
+    error: string;
+    loading: boolean;
+}
+
+// QueuesPanel is the right hand sidebar that lists the queues of the current
+// channel and lets the system admins manage them.
+export class QueuesPanel extends React.PureComponent<Props, State> {
+    private client = new Client();
+
+    constructor(props: Props) {
+        super(props);
+        this.state = {
+            queues: [],
+            selected: null,
+            editingMessageId: '',
+            editingSchedule: false,
+            draft: '',
+            newMessage: '',
+            draggedMessageId: '',
+            error: '',
+            loading: false,
+        };
+    }
+
+    public componentDidMount(): void {
+        this.loadQueues();
+    }
+
+    public componentDidUpdate(prevProps: Props): void {
+        if (prevProps.channelId !== this.props.channelId) {
+            this.setState({selected: null});
+            this.loadQueues();
+        }
+    }
+
+    private loadQueues = async (): Promise<void> => {
+        this.setState({loading: true, error: ''});
+        try {
+            const queues: Queue[] = await this.client.getQueues(this.props.channelId);
+            this.setState({queues, loading: false});
+        } catch (e) {
+            this.setState({loading: false, error: errorMessage(e)});
+        }
+    }
+
+    // run calls the API and shows the updated queue, or the error.
+    private run = async (request: () => Promise<Queue>): Promise<void> => {
+        this.setState({error: ''});
+        try {
+            const selected = await request();
+            this.setState({selected, editingMessageId: '', editingSchedule: false, draft: ''});
+        } catch (e) {
+            this.setState({error: errorMessage(e)});
+        }
+    }
+
+    private selectQueue = (name: string): void => {
+        this.run(() => this.client.getQueue(name));
+    }
+
+    private back = (): void => {
+        this.setState({selected: null, error: ''});
+        this.loadQueues();
+    }
+
+    private togglePaused = (): void => {
+        const queue = this.state.selected;
+        if (!queue) {
+            return;
+        }
+        this.run(() => (queue.paused ? this.client.resumeQueue(queue.name) : this.client.pauseQueue(queue.name)));
+    }
+
+    private saveSchedule = (): void => {
+        const queue = this.state.selected;
+        if (queue) {
+            this.run(() => this.client.setQueueSchedule(queue.name, this.state.draft));
+        }
+    }
+
+    private saveMessage = (): void => {
+        const queue = this.state.selected;
+        if (queue) {
+            this.run(() => this.client.editQueueMessage(queue.name, this.state.editingMessageId, this.state.draft));
+        }
+    }
+
+    private deleteMessage = (messageId: string): void => {
+        const queue = this.state.selected;
+        if (queue) {
+            this.run(() => this.client.deleteQueueMessage(queue.name, messageId));
+        }
+    }
+
+    private addMessage = async (): Promise<void> => {
+        const queue = this.state.selected;
+        if (queue && this.state.newMessage.trim()) {
+            await this.run(() => this.client.addQueueMessage(queue.name, this.state.newMessage));
+            if (!this.state.error) {
+                this.setState({newMessage: ''});
+            }
+        }
+    }
+
+    private importFile = async (e: React.ChangeEvent<HTMLInputElement>): Promise<void> => {
+        const queue = this.state.selected;
+        const file = e.target.files && e.target.files[0];
+        e.target.value = '';
+        if (!queue || !file) {
+            return;
+        }
+        this.setState({error: ''});
+        try {
+            await this.client.importQueueMessages(queue.name, file);
+            this.selectQueue(queue.name);
+        } catch (err) {
+            this.setState({error: errorMessage(err)});
+        }
+    }
+
+    private dropMessage = (targetId: string): void => {
+        const queue = this.state.selected;
+        const draggedId = this.state.draggedMessageId;
+        this.setState({draggedMessageId: ''});
+        if (!queue || !queue.messages || !draggedId || draggedId === targetId) {
+            return;
+        }
+        const ids = queue.messages.map((message) => message.id).filter((id) => id !== draggedId);
+        ids.splice(ids.indexOf(targetId), 0, draggedId);
+        this.run(() => this.client.reorderQueueMessages(queue.name, ids));
+    }
+
+    private renderNextExecution(queue: Queue): string {
+        if (queue.paused) {
+            return 'Paused';
+        }
+        if (!queue.next_execution) {
+            return 'No more executions';
+        }
+        return `Next run: ${new Date(queue.next_execution).toLocaleString()}`;
+    }
+
+    private renderList(): React.ReactNode {
+        if (this.state.loading) {
+            return <p>{'Loading...'}</p>;
+        }
+        if (this.state.queues.length === 0) {
+            return <p>{'There are no queues in this channel, create one with /messages-queue create.'}</p>;
+        }
+        return (
+            <ul className='messages-queue-list'>
+                {this.state.queues.map((queue) => (
+                    <li key={queue.name}>
+                        <a onClick={() => this.selectQueue(queue.name)}>
+                            <strong>{queue.name}</strong>
+                        </a>
+                        <div>{`${queue.schedule} (${queue.timezone})`}</div>
+                        <div>{`${queue.pending} pending, ${this.renderNextExecution(queue)}`}</div>
+                    </li>
+                ))}
+            </ul>
+        );
+    }
+
+    private renderMessage(message: QueueMessage, position: number): React.ReactNode {
+        if (this.state.editingMessageId === message.id) {
+            return (
+                <li key={message.id}>
+                    <textarea
+                        className='form-control'
+                        rows={4}
+                        value={this.state.draft}
+                        onChange={(e) => this.setState({draft: e.target.value})}
+                    />
+                    <button
+                        className='btn btn-primary btn-sm'
+                        onClick={this.saveMessage}
+                    >
+                        {'Save'}
+                    </button>
+                    <button
+                        className='btn btn-link btn-sm'
+                        onClick={() => this.setState({editingMessageId: ''})}
+                    >
+                        {'Cancel'}
+                    </button>
+                </li>
+            );
+        }
+        return (
+            <li
+                key={message.id}
+                draggable={true}
+                onDragStart={() => this.setState({draggedMessageId: message.id})}
+                onDragOver={(e) => e.preventDefault()}
+                onDrop={() => this.dropMessage(message.id)}
+                style={{cursor: 'move', opacity: this.state.draggedMessageId === message.id ? 0.5 : 1}}
+            >
+                <div>
+                    <strong>{`${position} · ${message.id}`}</strong>
+                    {message.file_ids && message.file_ids.length > 0 && ` (${message.file_ids.length} files)`}
+                </div>
+                <div style={{whiteSpace: 'pre-wrap'}}>{message.message}</div>
+                <button
+                    className='btn btn-link btn-sm'
+                    onClick={() => this.setState({editingMessageId: message.id, draft: message.message})}
+                >
+                    {'Edit'}
+                </button>
+                <button
+                    className='btn btn-link btn-sm'
+                    onClick={() => this.deleteMessage(message.id)}
+                >
+                    {'Delete'}
+                </button>
+            </li>
+        );
+    }
+
+    private renderQueue(queue: Queue): React.ReactNode {
+        return (
+            <div>
+                <a onClick={this.back}>{'< All queues'}</a>
+                <h4>{queue.name}</h4>
+                {this.state.editingSchedule ? (
+                    <div>
+                        <input
+                            className='form-control'
+                            value={this.state.draft}
+                            onChange={(e) => this.setState({draft: e.target.value})}
+                        />
+                        <button
+                            className='btn btn-primary btn-sm'
+                            onClick={this.saveSchedule}
+                        >
+                            {'Save'}
+                        </button>
+                        <button
+                            className='btn btn-link btn-sm'
+                            onClick={() => this.setState({editingSchedule: false})}
+                        >
+                            {'Cancel'}
+                        </button>
+                    </div>
+                ) : (
+                    <div>
+                        {`Schedule: ${queue.schedule} (${queue.timezone}) `}
+                        <a onClick={() => this.setState({editingSchedule: true, draft: queue.schedule})}>{'Edit'}</a>
+                    </div>
+                )}
+                {queue.lifecycle && <div>{queue.lifecycle}</div>}
+                <div>{this.renderNextExecution(queue)}</div>
+                <button
+                    className='btn btn-default btn-sm'
+                    onClick={this.togglePaused}
+                >
+                    {queue.paused ? 'Resume' : 'Pause'}
+                </button>
+                <label className='btn btn-default btn-sm'>
+                    {'Import'}
+                    <input
+                        type='file'
+                        accept='.csv,.json,.md,.markdown,.txt'
+                        style={{display: 'none'}}
+                        onChange={this.importFile}
+                    />
+                </label>
+                <h5>{`${(queue.messages || []).length} pending messages`}</h5>
+                <ol className='messages-queue-messages'>
+                    {(queue.messages || []).map((message, idx) => this.renderMessage(message, idx))}
+                </ol>
+                <textarea
+                    className='form-control'
+                    rows={3}
+                    placeholder='New message'
+                    value={this.state.newMessage}
+                    onChange={(e) => this.setState({newMessage: e.target.value})}
+                />
+                <button
+                    className='btn btn-primary btn-sm'
+                    onClick={this.addMessage}
+                >
+                    {'Add message'}
+                </button>
+            </div>
+        );
+    }
+
+    public render(): React.ReactNode {
+        return (
+            <div style={{padding: '12px', overflowY: 'auto', height: '100%'}}>
+                {this.state.error && <div className='error-text'>{this.state.error}</div>}
+                {this.state.selected ? this.renderQueue(this.state.selected) : this.renderList()}
+            </div>
+        );
+    }
+}
+
+const mapStateToProps = (state: any): Props => ({
+    channelId: getCurrentChannelId(state),
+});
+
+export default connect(mapStateToProps)(QueuesPanel);
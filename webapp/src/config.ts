@@ -0,0 +1,6 @@
+// config has the plugin settings needed by the webapp, loaded when the plugin
+// is initialized.
+export const config = {
+    queueManagers: 'system_admins',
+    enableOnlineDeferral: true,
+};
@@ -1,5 +1,14 @@
+import React from 'react';
+import {getCurrentUser} from 'mattermost-redux/selectors/entities/users';
+import {getPost} from 'mattermost-redux/selectors/entities/posts';
+import {isSystemAdmin} from 'mattermost-redux/utils/user_utils';
+
 import {id as pluginId} from './manifest';
 import Client from './client';
+import {config} from './config';
+import PostActionModal from './components/post_action_modal';
+import QueuesPanel from './components/queues_panel';
+import {openPostAction} from './post_actions';
 
 let activityFunc: () => void;
 let lastActivityTime = 0;
@@ -7,7 +16,7 @@ const activityTimeout = 1 * 60 * 1000; // 1 min
 
 export default class Plugin {
     // eslint-disable-next-line no-unused-vars
-    public initialize(): void {
+    public initialize(registry: any, store: any): void {
         // @see https://developers.mattermost.com/extend/plugins/webapp/reference/
         activityFunc = (): void => {
             const now = new Date().getTime();
@@ -20,6 +29,46 @@ export default class Plugin {
         };
 
         document.addEventListener('click', activityFunc);
+
+        registry.registerRootComponent(PostActionModal);
+
+        (new Client()).getConfig().then((data) => {
+            config.queueManagers = data.queue_managers;
+            config.enableOnlineDeferral = data.enable_online_deferral;
+        }).catch(() => {}); // eslint-disable-line no-empty-function
+
+        // Only system admins can manage queues by default, otherwise the
+        // server checks the permissions of each channel.
+        const canManageQueues = (): boolean => {
+            const user = getCurrentUser(store.getState());
+            return Boolean(user && (isSystemAdmin(user.roles) || config.queueManagers !== 'system_admins'));
+        };
+
+        const {showRHSPlugin} = registry.registerRightHandSidebarComponent(QueuesPanel, 'Messages queues');
+        registry.registerChannelHeaderButtonAction(
+            React.createElement('i', {className: 'icon fa fa-list-ol'}),
+            () => {
+                if (canManageQueues()) {
+                    store.dispatch(showRHSPlugin);
+                }
+            },
+            'Messages queues',
+            'Manage the messages queues of the channel',
+        );
+
+        const postChannelId = (postId: string): string => {
+            const post = getPost(store.getState(), postId);
+            return post ? post.channel_id : '';
+        };
+        registry.registerPostDropdownMenuAction(
+            'Add to queue',
+            (postId: string) => openPostAction({type: 'queue', postId, channelId: postChannelId(postId)}),
+            canManageQueues,
+        );
+        registry.registerPostDropdownMenuAction(
+            'Defer copy',
+            (postId: string) => openPostAction({type: 'defer', postId, channelId: postChannelId(postId)}),
+        );
     }
 
     public deinitialize(): void {
@@ -0,0 +1,25 @@
+export type PostActionType = 'queue' | 'defer';
+
+export interface PostAction {
+    type: PostActionType;
+    postId: string;
+    channelId: string;
+}
+
+type Listener = (action: PostAction | null) => void;
+
+let listeners: Listener[] = [];
+
+// openPostAction shows the dialog of the post menu action.
+export function openPostAction(action: PostAction | null): void {
+    listeners.forEach((listener) => listener(action));
+}
+
+// subscribePostActions calls the listener every time a post menu action is
+// opened or closed, and returns a function to stop listening.
+export function subscribePostActions(listener: Listener): () => void {
+    listeners.push(listener);
+    return () => {
+        listeners = listeners.filter((l) => l !== listener);
+    };
+}